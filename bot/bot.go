@@ -1,36 +1,78 @@
 package bot
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"log"
 	"modwithfriends"
+	"modwithfriends/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
-var (
-	ErrUserDeactivated = errors.New("User has deactivated the use of bot")
-)
+const maxSendRetries = 2
+
+// maxRetryAfter is the longest send waits out a flood limit before giving up,
+// so that a broadcast is not held up for as long as Telegram asks.
+const maxRetryAfter = 10 * time.Second
 
 type Bot struct {
-	client *tb.Bot
-	routes *Routes
+	client  *tb.Bot
+	routes  *Routes
+	polls   *pollTracker
+	webhook *webhookPoller
+
+	// handlers are the updates being handled.
+	handlers sync.WaitGroup
+	stopping chan struct{}
 }
 
-func NewBot(token string, f func(*tb.Bot) *Routes) (*Bot, error) {
+// NewBot long polls Telegram for updates, or has them pushed to the server
+// when given a webhook.
+func NewBot(token string, webhook *Webhook, f func(*tb.Bot) *Routes) (*Bot, error) {
+	polls := &pollTracker{transport: http.DefaultTransport}
+
+	stopping := make(chan struct{})
+
+	var poller tb.Poller = &tb.LongPoller{Timeout: 10 * time.Second}
+	var wp *webhookPoller
+	if webhook != nil {
+		var err error
+		wp, err = newWebhookPoller(*webhook, polls, stopping)
+		if err != nil {
+			return nil, err
+		}
+		poller = wp
+	}
+
+	// Handlers are run synchronously by the client so that the bot can keep
+	// track of them as it runs them in the background itself.
 	client, err := tb.NewBot(tb.Settings{
-		Token:  token,
-		Poller: &tb.LongPoller{Timeout: 10 * time.Second},
+		Token:       token,
+		Poller:      poller,
+		Client:      &http.Client{Transport: polls},
+		Synchronous: true,
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to start telegram bot: %w", err)
 	}
 
+	if wp != nil {
+		wp.client = client
+	}
+
 	bot := &Bot{
-		client: client,
-		routes: f(client),
+		client:   client,
+		routes:   f(client),
+		polls:    polls,
+		webhook:  wp,
+		stopping: stopping,
 	}
 	bot.registerRoutes(bot.routes.get()...)
 
@@ -38,35 +80,172 @@ func NewBot(token string, f func(*tb.Bot) *Routes) (*Bot, error) {
 }
 
 func (b *Bot) Start() {
+	// Telegram refuses to be polled while a webhook is set, e.g. by an
+	// earlier deployment in webhook mode.
+	if b.webhook == nil {
+		if err := b.client.RemoveWebhook(); err != nil {
+			log.Printf("Failed to remove telegram webhook: %s", Classify(err))
+		}
+	}
+
 	b.client.Start()
 }
 
+// Stop stops taking updates and cuts running broadcasts short, then waits
+// until ctx is done for the updates that were taken to be handled. Users a
+// broadcast was cut short of are failures with CodeInterrupted.
+func (b *Bot) Stop(ctx context.Context) error {
+	close(b.stopping)
+	b.client.Stop()
+
+	// Updates that were fetched but not handled yet are handled all the same,
+	// as Telegram has already been told they were received.
+	for drained := false; !drained; {
+		select {
+		case update := <-b.client.Updates:
+			b.client.ProcessUpdate(update)
+		default:
+			drained = true
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Failed to finish handling telegram updates: %w", ctx.Err())
+	}
+}
+
+// stopped reports whether the bot has been told to stop.
+func (b *Bot) stopped() bool {
+	select {
+	case <-b.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d unless the bot is told to stop first, reporting whether
+// it waited for all of d.
+func (b *Bot) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-b.stopping:
+		return false
+	}
+}
+
+// LastPoll is when updates were last fetched from Telegram, or in webhook
+// mode when the webhook was last confirmed or pushed an update. It is the
+// zero time if neither has happened yet.
+func (b *Bot) LastPoll() time.Time {
+	return b.polls.last()
+}
+
+// Webhook is what receives the updates pushed by Telegram, it is nil unless
+// the bot is in webhook mode.
+func (b *Bot) Webhook() modwithfriends.TelegramWebhook {
+	if b.webhook == nil {
+		return nil
+	}
+	return b.webhook
+}
+
 func (b *Bot) registerRoutes(routes ...route) {
 	for _, route := range routes {
-		b.client.Handle(route.Endpoint, route.Handler)
+		b.client.Handle(route.Endpoint, b.tracked(counted(route)))
+	}
+}
+
+// tracked runs the handler in the background, keeping track of it so that
+// Stop can wait for it.
+func (b *Bot) tracked(handler func(*tb.Message)) func(*tb.Message) {
+	return func(msg *tb.Message) {
+		b.handlers.Add(1)
+		go func() {
+			defer b.handlers.Done()
+			handler(msg)
+		}()
 	}
 }
 
+// counted counts the messages handled by the route in the bot's metrics.
+func counted(r route) func(*tb.Message) {
+	command := metrics.Commands.WithLabelValues(strings.TrimPrefix(fmt.Sprint(r.Endpoint), "\a"))
+	return func(msg *tb.Message) {
+		command.Inc()
+		r.Handler(msg)
+	}
+}
+
+func (b *Bot) Notify(chatID modwithfriends.ChatID, n modwithfriends.Notification) error {
+	return b.send(chatID, n.Message)
+}
+
 func (b *Bot) Broadcast(chatIDs []modwithfriends.ChatID, msg string, opts *modwithfriends.BroadcastRate) []modwithfriends.BroadcastFailure {
+	return b.broadcast(chatIDs, func(modwithfriends.ChatID) (string, error) {
+		return msg, nil
+	}, opts)
+}
+
+func (b *Bot) BroadcastTemplate(chatIDs []modwithfriends.ChatID, tmpl *modwithfriends.MessageTemplate, opts *modwithfriends.BroadcastRate) []modwithfriends.BroadcastFailure {
+	if msg, ok := tmpl.Static(); ok {
+		return b.Broadcast(chatIDs, msg, opts)
+	}
+
+	return b.broadcast(chatIDs, func(chatID modwithfriends.ChatID) (string, error) {
+		recipient, err := b.recipient(chatID)
+		if err != nil {
+			return "", err
+		}
+		return tmpl.Execute(recipient)
+	}, opts)
+}
+
+func (b *Bot) broadcast(chatIDs []modwithfriends.ChatID, msgFor func(modwithfriends.ChatID) (string, error), opts *modwithfriends.BroadcastRate) []modwithfriends.BroadcastFailure {
 	broadcastFailures := []modwithfriends.BroadcastFailure{}
 
 	for index, chatID := range chatIDs {
 		if opts != nil && (index+1)%opts.Rate == 0 {
-			time.Sleep(opts.Delay)
+			b.sleep(opts.Delay)
 		}
-		_, err := b.client.Send(&tb.User{ID: int(chatID)}, msg)
-		if err != nil {
-			tbErr, ok := err.(*tb.APIError)
-			if ok && tbErr == tb.ErrBlockedByUser {
-				err = ErrUserDeactivated
+
+		if b.stopped() {
+			for _, rest := range chatIDs[index:] {
+				broadcastFailures = append(broadcastFailures, modwithfriends.BroadcastFailure{
+					User:         rest,
+					Reason:       errInterrupted,
+					ReasonString: errInterrupted.Error(),
+					Code:         string(CodeInterrupted),
+				})
 			}
+			break
+		}
 
+		msg, err := msgFor(chatID)
+		if err == nil {
+			err = b.send(chatID, msg)
+		}
+		if err != nil {
 			broadcastFailures = append(
 				broadcastFailures,
 				modwithfriends.BroadcastFailure{
 					User:         chatID,
 					Reason:       err,
 					ReasonString: err.Error(),
+					Code:         string(ErrorCodeOf(err)),
 				},
 			)
 		}
@@ -74,3 +253,64 @@ func (b *Bot) Broadcast(chatIDs []modwithfriends.ChatID, msg string, opts *modwi
 
 	return broadcastFailures
 }
+
+func (b *Bot) Profile(chatID modwithfriends.ChatID) (modwithfriends.Profile, error) {
+	chat, err := b.client.ChatByID(strconv.Itoa(int(chatID)))
+	if err != nil {
+		return modwithfriends.Profile{}, fmt.Errorf("Failed to get user's chat from telegram: %w", Classify(err))
+	}
+
+	return modwithfriends.Profile{
+		FirstName: chat.FirstName,
+		LastName:  chat.LastName,
+		Username:  chat.Username,
+	}, nil
+}
+
+func (b *Bot) recipient(chatID modwithfriends.ChatID) (modwithfriends.Recipient, error) {
+	profile, err := b.Profile(chatID)
+	if err != nil {
+		return modwithfriends.Recipient{}, fmt.Errorf("Failed to get recipient's profile: %w", err)
+	}
+
+	groups, err := b.routes.userService.Groups(chatID)
+	if err != nil {
+		return modwithfriends.Recipient{}, fmt.Errorf("Failed to get recipient's groups: %w", err)
+	}
+
+	recipient := modwithfriends.NewRecipient(chatID, groups)
+	recipient.FirstName = profile.FirstName
+	recipient.LastName = profile.LastName
+	recipient.Username = profile.Username
+
+	return recipient, nil
+}
+
+// send delivers msg to the user, retrying failures that are worth retrying.
+func (b *Bot) send(chatID modwithfriends.ChatID, msg string) error {
+	var sendErr *SendError
+
+	for attempt := 0; attempt <= maxSendRetries; attempt++ {
+		if sendErr != nil {
+			delay := sendErr.RetryAfter
+			if delay == 0 {
+				delay = time.Duration(attempt) * time.Second
+			}
+			if delay > maxRetryAfter || !b.sleep(delay) {
+				break
+			}
+		}
+
+		_, err := b.client.Send(&tb.User{ID: int(chatID)}, msg)
+		if err == nil {
+			return nil
+		}
+
+		sendErr = Classify(err)
+		if sendErr.Action != ActionRetry {
+			break
+		}
+	}
+
+	return sendErr
+}
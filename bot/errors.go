@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	ErrUserDeactivated = errors.New("User has deactivated the use of bot")
+)
+
+// Action is what the caller should do about a message that failed to send.
+type Action string
+
+var (
+	// ActionDeactivate means the user can no longer be reached by the bot.
+	ActionDeactivate = Action("DEACTIVATE")
+	// ActionRetry means sending the message again later may succeed.
+	ActionRetry = Action("RETRY")
+	// ActionAlert means something is wrong with the bot or the message itself.
+	ActionAlert = Action("ALERT")
+)
+
+// ErrorCode identifies the kind of failure a SendError is.
+type ErrorCode string
+
+var (
+	CodeBlockedByUser   = ErrorCode("BLOCKED_BY_USER")
+	CodeUserDeactivated = ErrorCode("USER_DEACTIVATED")
+	CodeChatNotFound    = ErrorCode("CHAT_NOT_FOUND")
+	CodeNotStarted      = ErrorCode("NOT_STARTED_BY_USER")
+	CodeBotKicked       = ErrorCode("BOT_KICKED")
+	CodeFloodWait       = ErrorCode("FLOOD_WAIT")
+	CodeNetwork         = ErrorCode("NETWORK")
+	CodeTelegramDown    = ErrorCode("TELEGRAM_INTERNAL")
+	CodeUnauthorized    = ErrorCode("UNAUTHORIZED")
+	CodeBadRequest      = ErrorCode("BAD_REQUEST")
+	// CodeInterrupted means the bot stopped before the message was sent.
+	CodeInterrupted = ErrorCode("INTERRUPTED")
+	CodeUnknown     = ErrorCode("UNKNOWN")
+)
+
+var errorCodeActions = map[ErrorCode]Action{
+	CodeBlockedByUser:   ActionDeactivate,
+	CodeUserDeactivated: ActionDeactivate,
+	CodeChatNotFound:    ActionDeactivate,
+	CodeNotStarted:      ActionDeactivate,
+	CodeBotKicked:       ActionDeactivate,
+	CodeFloodWait:       ActionRetry,
+	CodeNetwork:         ActionRetry,
+	CodeTelegramDown:    ActionRetry,
+	CodeUnauthorized:    ActionAlert,
+	CodeBadRequest:      ActionAlert,
+	CodeInterrupted:     ActionRetry,
+	CodeUnknown:         ActionAlert,
+}
+
+var errInterrupted = &SendError{
+	Code:   CodeInterrupted,
+	Action: ActionRetry,
+	Err:    errors.New("Bot stopped before the message was sent"),
+}
+
+// SendError is a classified error from sending a message over Telegram.
+// Errors that call for deactivation match ErrUserDeactivated with errors.Is.
+type SendError struct {
+	Code       ErrorCode
+	Action     Action
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (se *SendError) Error() string {
+	return se.Err.Error()
+}
+
+func (se *SendError) Unwrap() error {
+	return se.Err
+}
+
+func (se *SendError) Is(target error) bool {
+	return target == ErrUserDeactivated && se.Action == ActionDeactivate
+}
+
+// Classify turns an error returned by the telegram client into a SendError.
+func Classify(err error) *SendError {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr
+	}
+
+	var code ErrorCode
+	var retryAfter time.Duration
+
+	var floodErr tb.FloodError
+	var apiErr *tb.APIError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &floodErr):
+		code = CodeFloodWait
+		retryAfter = time.Duration(floodErr.RetryAfter) * time.Second
+	case errors.As(err, &apiErr):
+		code = classifyDescription(strings.ToLower(apiErr.Description))
+		if code == CodeUnknown && apiErr.Code == 400 {
+			code = CodeBadRequest
+		} else if code == CodeUnknown && apiErr.Code >= 500 {
+			code = CodeTelegramDown
+		}
+	case errors.As(err, &netErr):
+		code = CodeNetwork
+	default:
+		code = classifyDescription(strings.ToLower(err.Error()))
+	}
+
+	return &SendError{
+		Code:       code,
+		Action:     errorCodeActions[code],
+		RetryAfter: retryAfter,
+		Err:        err,
+	}
+}
+
+// ErrorCodeOf returns the code of the SendError in err's chain, or
+// CodeUnknown if there is none.
+func ErrorCodeOf(err error) ErrorCode {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Code
+	}
+	return CodeUnknown
+}
+
+func classifyDescription(desc string) ErrorCode {
+	switch {
+	case strings.Contains(desc, "blocked by the user"):
+		return CodeBlockedByUser
+	case strings.Contains(desc, "user is deactivated"):
+		return CodeUserDeactivated
+	case strings.Contains(desc, "chat not found"):
+		return CodeChatNotFound
+	case strings.Contains(desc, "can't initiate conversation"):
+		return CodeNotStarted
+	case strings.Contains(desc, "bot was kicked"):
+		return CodeBotKicked
+	case strings.Contains(desc, "too many requests"):
+		return CodeFloodWait
+	case strings.Contains(desc, "unauthorized"):
+		return CodeUnauthorized
+	case strings.Contains(desc, "internal server error"), strings.Contains(desc, "bad gateway"):
+		return CodeTelegramDown
+	case strings.Contains(desc, "bad request"):
+		return CodeBadRequest
+	default:
+		return CodeUnknown
+	}
+}
@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		code       ErrorCode
+		action     Action
+		retryAfter time.Duration
+	}{
+		{
+			name:       "flood",
+			err:        tb.FloodError{APIError: tb.NewAPIError(429, "Too Many Requests: retry after 7"), RetryAfter: 7},
+			code:       CodeFloodWait,
+			action:     ActionRetry,
+			retryAfter: 7 * time.Second,
+		},
+		{
+			name:   "blocked",
+			err:    tb.ErrBlockedByUser,
+			code:   CodeBlockedByUser,
+			action: ActionDeactivate,
+		},
+		{
+			name:   "blocked without api error",
+			err:    errors.New("telegram: Forbidden: bot was blocked by the user (403)"),
+			code:   CodeBlockedByUser,
+			action: ActionDeactivate,
+		},
+		{
+			name:   "chat not found",
+			err:    tb.NewAPIError(400, "Bad Request: chat not found"),
+			code:   CodeChatNotFound,
+			action: ActionDeactivate,
+		},
+		{
+			name:   "user deactivated",
+			err:    tb.NewAPIError(403, "Forbidden: user is deactivated"),
+			code:   CodeUserDeactivated,
+			action: ActionDeactivate,
+		},
+		{
+			name:   "bad request",
+			err:    tb.NewAPIError(400, "Bad Request: message text is empty"),
+			code:   CodeBadRequest,
+			action: ActionAlert,
+		},
+		{
+			name:   "telegram down",
+			err:    tb.NewAPIError(502, "Gateway Timeout"),
+			code:   CodeTelegramDown,
+			action: ActionRetry,
+		},
+		{
+			name:   "unauthorized",
+			err:    tb.NewAPIError(401, "Unauthorized"),
+			code:   CodeUnauthorized,
+			action: ActionAlert,
+		},
+		{
+			name:   "network timeout",
+			err:    fmt.Errorf("telegram: %w", timeoutError{}),
+			code:   CodeNetwork,
+			action: ActionRetry,
+		},
+		{
+			name:   "unknown",
+			err:    errors.New("something else"),
+			code:   CodeUnknown,
+			action: ActionAlert,
+		},
+		{
+			name:   "already classified",
+			err:    fmt.Errorf("Failed to send: %w", errInterrupted),
+			code:   CodeInterrupted,
+			action: ActionRetry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sendErr := Classify(tt.err)
+			if sendErr.Code != tt.code {
+				t.Errorf("Code = %s, want %s", sendErr.Code, tt.code)
+			}
+			if sendErr.Action != tt.action {
+				t.Errorf("Action = %s, want %s", sendErr.Action, tt.action)
+			}
+			if sendErr.RetryAfter != tt.retryAfter {
+				t.Errorf("RetryAfter = %s, want %s", sendErr.RetryAfter, tt.retryAfter)
+			}
+			if got, want := errors.Is(sendErr, ErrUserDeactivated), tt.action == ActionDeactivate; got != want {
+				t.Errorf("errors.Is(err, ErrUserDeactivated) = %v, want %v", got, want)
+			}
+		})
+	}
+}
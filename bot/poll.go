@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// pollTracker notes when updates were last fetched from Telegram, or in
+// webhook mode when the webhook was last confirmed, so that a stuck poller
+// can be told apart from a quiet one.
+type pollTracker struct {
+	transport http.RoundTripper
+	lastPoll  int64
+}
+
+func (pt *pollTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := pt.transport.RoundTrip(req)
+	if err == nil && res.StatusCode == http.StatusOK && strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		pt.mark()
+	}
+	return res, err
+}
+
+func (pt *pollTracker) mark() {
+	atomic.StoreInt64(&pt.lastPoll, time.Now().UnixNano())
+}
+
+func (pt *pollTracker) last() time.Time {
+	nanos := atomic.LoadInt64(&pt.lastPoll)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
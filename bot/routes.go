@@ -3,6 +3,7 @@ package bot
 import (
 	"fmt"
 	"modwithfriends"
+	"net/mail"
 	"strings"
 	"sync"
 
@@ -45,7 +46,10 @@ func (r *Routes) handleStart(msg *tb.Message) {
 	chatID := modwithfriends.ChatID(msg.Chat.ID)
 
 	err := r.userService.CreateUser(chatID)
-	if err != nil && err != modwithfriends.ErrDuplicateEntityFound {
+	if err == modwithfriends.ErrDuplicateEntityFound {
+		err = r.userService.ActivateUser(chatID)
+	}
+	if err != nil {
 		r.bot.Send(msg.Sender, "Registration has failed, please contact admin!")
 		return
 	}
@@ -55,6 +59,7 @@ func (r *Routes) handleStart(msg *tb.Message) {
 			"/find GEX1007 - Register a module you're taking and be notified with a Telegram group invite when your team is fully assembled.\n\n"+
 			"/groups - View every mod groups you're assigned to along with its progress.\n\n"+
 			"/leave GEX1007 - Leave a mod group that has not been assigned a group invite link.\n\n"+
+			"/email you@example.com - Register an email to receive your group invite links at if Telegram fails to deliver them.\n\n"+
 			"/feedback Your message - Let us know your thoughts and issues and we'll get back to you ASAP.\n\n"+
 			"Enjoyed the bot? Forward https://tinyurl.com/fwens with your friends so we may group them with more awesome people!\n\n"+
 			"For announcements about the bot, checkout our channel @modwithfriends 📢\n\n"+
@@ -131,11 +136,7 @@ func (r *Routes) handleFind(msg *tb.Message) {
 
 	groups, err := r.groupService.GroupsBy(modwithfriends.GroupQuery{
 		ModuleCode: &moduleCode,
-		Invited:    false,
-		MemberCriteriaQuery: &modwithfriends.MemberCriteriaQuery{
-			Condition: modwithfriends.LessThan,
-			Count:     5,
-		},
+		States:     []modwithfriends.GroupState{modwithfriends.GroupStateForming},
 	})
 	if err != nil {
 		r.bot.Send(msg.Sender, "An unexpected error has occurred, please contact admin!")
@@ -249,6 +250,52 @@ func (r *Routes) handleLeave(msg *tb.Message) {
 	r.bot.Send(msg.Sender, fmt.Sprintf("Yee haw, you're no longer assigned to any %s mod group 🤠", moduleCode))
 }
 
+func (r *Routes) handleEmail(msg *tb.Message) {
+	chatID := modwithfriends.ChatID(msg.Chat.ID)
+	payload := strings.TrimSpace(msg.Payload)
+
+	if payload == "" {
+		email, err := r.userService.Email(chatID)
+		if err != nil {
+			r.bot.Send(msg.Sender, "An unexpected error has occurred, please contact admin!")
+			return
+		}
+
+		if email == nil {
+			r.bot.Send(msg.Sender, "You have not registered an email. E.g. /email you@example.com")
+			return
+		}
+		r.bot.Send(msg.Sender, fmt.Sprintf("Your registered email is %s, use /email remove to remove it 📧", *email))
+		return
+	}
+
+	var email *string
+	if strings.ToLower(payload) != "remove" {
+		addr, err := mail.ParseAddress(payload)
+		if err != nil || addr.Address != payload {
+			r.bot.Send(msg.Sender, "Please provide a valid email. E.g. /email you@example.com")
+			return
+		}
+		email = &addr.Address
+	}
+
+	err := r.userService.UpdateEmail(chatID, email)
+	if err == modwithfriends.ErrEntityNotFound {
+		r.bot.Send(msg.Sender, "Please /start the bot before registering an email!")
+		return
+	}
+	if err != nil {
+		r.bot.Send(msg.Sender, "An unexpected error has occurred, please contact admin!")
+		return
+	}
+
+	if email == nil {
+		r.bot.Send(msg.Sender, "Your email has been removed 🗑")
+		return
+	}
+	r.bot.Send(msg.Sender, fmt.Sprintf("We'll email %s if we can't reach you here 📧", *email))
+}
+
 func (r *Routes) handleFeedback(msg *tb.Message) {
 	isEmptyFeedback := strings.ReplaceAll(strings.ToUpper(msg.Payload), " ", "") == ""
 	if isEmptyFeedback {
@@ -311,6 +358,10 @@ func (r *Routes) get() []route {
 			Endpoint: "/leave",
 			Handler:  r.handleLeave,
 		},
+		{
+			Endpoint: "/email",
+			Handler:  r.handleEmail,
+		},
 		{
 			Endpoint: "/feedback",
 			Handler:  r.handleFeedback,
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	webhookPathPrefix = "/telegram/"
+	// webhookCheckInterval is how often the webhook is checked to still be
+	// set, well within the time the health check allows between polls.
+	webhookCheckInterval = 20 * time.Second
+	maxUpdateBytes       = 1 << 20
+)
+
+// secretRx is what Telegram accepts as a secret token, at a length that
+// cannot be guessed.
+var secretRx = regexp.MustCompile(`^[A-Za-z0-9_-]{32,256}$`)
+
+// Webhook has Telegram push updates to the server instead of the bot polling
+// for them, so that the bot does not need to be kept running.
+type Webhook struct {
+	// PublicURL is where the server can be reached by Telegram, e.g.
+	// https://modwithfriends.herokuapp.com. Without it the webhook is not
+	// set, so that updates can be posted by hand when trying it out locally.
+	PublicURL string
+	// Secret is sent by Telegram along with every update to prove that the
+	// update comes from it.
+	Secret string
+}
+
+// webhookPoller takes the place of the long poller in webhook mode. Rather
+// than fetching updates, it keeps the webhook set and hands the updates
+// pushed to ServeHTTP to the bot.
+type webhookPoller struct {
+	Webhook
+	client   *tb.Bot
+	polls    *pollTracker
+	stopping <-chan struct{}
+}
+
+func newWebhookPoller(w Webhook, polls *pollTracker, stopping <-chan struct{}) (*webhookPoller, error) {
+	if !secretRx.MatchString(w.Secret) {
+		return nil, errors.New("Failed to set up telegram webhook: secret must be 32 to 256 letters, digits, _ or -")
+	}
+	w.PublicURL = strings.TrimSuffix(w.PublicURL, "/")
+
+	return &webhookPoller{Webhook: w, polls: polls, stopping: stopping}, nil
+}
+
+// Path is where updates are pushed to. It is derived from the secret, so that
+// it cannot be guessed yet does not give the secret away in access logs.
+func (wp *webhookPoller) Path() string {
+	sum := sha256.Sum256([]byte(wp.Secret))
+	return webhookPathPrefix + hex.EncodeToString(sum[:16])
+}
+
+func (wp *webhookPoller) url() string {
+	return wp.PublicURL + wp.Path()
+}
+
+func (wp *webhookPoller) Poll(b *tb.Bot, updates chan tb.Update, stop chan struct{}) {
+	ticker := time.NewTicker(webhookCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		wp.check(b)
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check sets the webhook if it is not set to the server, e.g. because it was
+// removed by an instance in polling mode. Telegram is counted as polled
+// whenever the webhook is confirmed, so that a quiet bot is not taken to be
+// a stuck one.
+func (wp *webhookPoller) check(b *tb.Bot) {
+	if wp.PublicURL == "" {
+		wp.polls.mark()
+		return
+	}
+
+	info, err := b.GetWebhook()
+	if err != nil {
+		log.Printf("Failed to get telegram webhook: %s", Classify(err))
+		return
+	}
+
+	if info.Listen == wp.url() {
+		wp.polls.mark()
+		return
+	}
+
+	_, err = b.Raw("setWebhook", map[string]string{
+		"url":          wp.url(),
+		"secret_token": wp.Secret,
+	})
+	if err != nil {
+		log.Printf("Failed to set telegram webhook: %s", Classify(err))
+		return
+	}
+
+	log.Println("Telegram webhook is set")
+	wp.polls.mark()
+}
+
+// ServeHTTP hands the update to the bot once its secret token checks out.
+// Telegram retries updates that are not answered with a 200, so malformed
+// ones are acknowledged all the same, while ones that come in after the bot
+// is told to stop are left for the next instance.
+func (wp *webhookPoller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(wp.Secret)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	select {
+	case <-wp.stopping:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	update := tb.Update{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateBytes)).Decode(&update); err != nil {
+		log.Printf("Failed to decode telegram update: %s", err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	select {
+	case wp.client.Updates <- update:
+		wp.polls.mark()
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram gave up waiting and will send the update again.
+	}
+}
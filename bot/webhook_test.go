@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const testSecret = "0123456789abcdefghijklmnopqrstuvwxyz_-ABCDEF"
+
+func TestNewWebhookPollerRejectsWeakSecret(t *testing.T) {
+	for _, secret := range []string{"", "tooshort", strings.Repeat("a", 31), strings.Repeat("a", 32) + "!"} {
+		if _, err := newWebhookPoller(Webhook{Secret: secret}, &pollTracker{}, nil); err == nil {
+			t.Errorf("newWebhookPoller with secret %q succeeded, want an error", secret)
+		}
+	}
+}
+
+// TestWebhookServeHTTP posts an update recorded from Telegram to the webhook,
+// served at its path as the server does.
+func TestWebhookServeHTTP(t *testing.T) {
+	update, err := ioutil.ReadFile("testdata/start_update.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	polls := &pollTracker{}
+	stopping := make(chan struct{})
+	wp, err := newWebhookPoller(Webhook{Secret: testSecret}, polls, stopping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wp.client = &tb.Bot{Updates: make(chan tb.Update, 1)}
+
+	if !strings.HasPrefix(wp.Path(), webhookPathPrefix) || strings.Contains(wp.Path(), testSecret) {
+		t.Fatalf("Path() = %s, want it under %s without the secret", wp.Path(), webhookPathPrefix)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(wp.Path(), wp)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		body   []byte
+		status int
+		// delivered is whether the update reaches the bot.
+		delivered bool
+	}{
+		{"guessed path", webhookPathPrefix + "start", testSecret, update, http.StatusNotFound, false},
+		{"secret as path", webhookPathPrefix + testSecret, testSecret, update, http.StatusNotFound, false},
+		{"missing token", wp.Path(), "", update, http.StatusUnauthorized, false},
+		{"wrong token", wp.Path(), strings.Repeat("x", len(testSecret)), update, http.StatusUnauthorized, false},
+		{"malformed update", wp.Path(), testSecret, []byte(`{"update_id":`), http.StatusOK, false},
+		{"recorded update", wp.Path(), testSecret, update, http.StatusOK, true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(test.body))
+		if test.token != "" {
+			req.Header.Set(secretTokenHeader, test.token)
+		}
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != test.status {
+			t.Errorf("%s got %d, want %d", test.name, res.Code, test.status)
+		}
+
+		select {
+		case got := <-wp.client.Updates:
+			if !test.delivered {
+				t.Errorf("%s reached the bot", test.name)
+				continue
+			}
+			if got.ID != 572819341 || got.Message == nil || got.Message.Text != "/start" || got.Message.Sender.ID != 318204762 {
+				t.Errorf("%s reached the bot as %+v, want the recorded /start message", test.name, got)
+			}
+			if polls.last().IsZero() {
+				t.Errorf("%s did not count as a poll", test.name)
+			}
+		default:
+			if test.delivered {
+				t.Errorf("%s did not reach the bot", test.name)
+			}
+		}
+	}
+
+	// Updates that come in once the bot is stopping are left for the next
+	// instance.
+	close(stopping)
+	req := httptest.NewRequest(http.MethodPost, wp.Path(), bytes.NewReader(update))
+	req.Header.Set(secretTokenHeader, testSecret)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("update while stopping got %d, want %d", res.Code, http.StatusServiceUnavailable)
+	}
+	if len(wp.client.Updates) != 0 {
+		t.Error("update while stopping reached the bot")
+	}
+}
@@ -0,0 +1,107 @@
+// Command createadmin creates an admin who can log in to the dashboard, or
+// sets a new password for an existing one. The password is read from stdin:
+//
+//	go run cmd/createadmin/main.go -username alice
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"modwithfriends"
+	"modwithfriends/postgres"
+	"modwithfriends/sqlite"
+	"modwithfriends/sqlstore"
+	"modwithfriends/utils"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	envDeploymentType = "DEPLOYMENT_TYPE"
+	envDatabaseURL    = "DATABASE_URL"
+
+	minPasswordLength = 12
+)
+
+func main() {
+	username := flag.String("username", "", "username of the admin")
+	flag.Parse()
+
+	if *username == "" {
+		log.Fatal("Please provide the admin's username with -username")
+	}
+
+	deploymentType, exist := os.LookupEnv(envDeploymentType)
+	if !exist || deploymentType == "development" {
+		err := utils.LoadEnvironmentVariables()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	config, err := utils.GetConfig(envDatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatal("Failed to read password: ", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	if len(password) < minPasswordLength {
+		log.Fatalf("Please use a password of at least %d characters", minPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal("Failed to hash password: ", err)
+	}
+
+	var as modwithfriends.AdminService
+	if strings.HasPrefix(config[envDatabaseURL], sqlite.Scheme) {
+		db, err := sqlite.Open(config[envDatabaseURL])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		if _, err := sqlite.Migrate(db); err != nil {
+			log.Fatal(err)
+		}
+		as = &sqlstore.AdminService{DB: db, Dialect: sqlite.Dialect{}}
+	} else {
+		db, err := postgres.Open(config[envDatabaseURL])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		as = &sqlstore.AdminService{DB: db, Dialect: postgres.Dialect{}}
+	}
+
+	admin, err := as.AdminByUsername(*username)
+	switch {
+	case err == modwithfriends.ErrEntityNotFound:
+		_, err = as.CreateAdmin(modwithfriends.Admin{Username: *username, PasswordHash: string(hash)})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Created admin %s", *username)
+	case err != nil:
+		log.Fatal(err)
+	default:
+		admin.PasswordHash = string(hash)
+		err = as.UpdateAdmin(admin.ID, admin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Updated password of admin %s", *username)
+	}
+}
@@ -0,0 +1,132 @@
+// Command migrate applies or reverts the schema migrations, which the server
+// otherwise applies on boot:
+//
+//	go run cmd/migrate/main.go up
+//	go run cmd/migrate/main.go down 1
+//	go run cmd/migrate/main.go status
+//	go run cmd/migrate/main.go force 1
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"modwithfriends/postgres"
+	"modwithfriends/sqlite"
+	"modwithfriends/utils"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	envDeploymentType = "DEPLOYMENT_TYPE"
+	envDatabaseURL    = "DATABASE_URL"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up             apply the migrations the database has yet to be
+  down [steps]   revert the last steps migrations, 1 unless given
+  status         print the version of the database and the migrations
+  force VERSION  record the database as being at VERSION without migrating
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	deploymentType, exist := os.LookupEnv(envDeploymentType)
+	if !exist || deploymentType == "development" {
+		err := utils.LoadEnvironmentVariables()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	config, err := utils.GetConfig(envDatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// SQLite databases have no versions to revert to and are migrated on boot.
+	if strings.HasPrefix(config[envDatabaseURL], sqlite.Scheme) {
+		log.Fatal("Please let the server migrate SQLite databases as it boots")
+	}
+
+	db, err := postgres.Open(config[envDatabaseURL])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := postgres.Migrate(db)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			log.Println("Database is up to date")
+		}
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("Please provide a positive number of steps, not %q", flag.Arg(1))
+			}
+		}
+
+		reverted, err := postgres.Rollback(db, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		migrations, err := postgres.Migrations()
+		if err != nil {
+			log.Fatal(err)
+		}
+		version, err := postgres.SchemaVersion(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, m := range migrations {
+			status := "pending"
+			if m.Version <= version {
+				status = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, status)
+		}
+		fmt.Printf("Database is at version %d of %d\n", version, len(migrations))
+	case "force":
+		if flag.NArg() < 2 {
+			log.Fatal("Please provide the version to force")
+		}
+		version, err := strconv.Atoi(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Please provide a version number, not %q", flag.Arg(1))
+		}
+
+		if err := postgres.ForceVersion(db, version); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Database is recorded as being at version %d", version)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -1,21 +1,37 @@
 package main
 
 import (
+	"context"
 	"log"
+	"modwithfriends"
 	"modwithfriends/bot"
+	"modwithfriends/events"
 	"modwithfriends/http"
+	"modwithfriends/metrics"
+	"modwithfriends/notify"
 	"modwithfriends/postgres"
 	"modwithfriends/smtp"
+	"modwithfriends/sqlite"
+	"modwithfriends/sqlstore"
 	"modwithfriends/utils"
+	"modwithfriends/webhooks"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
+// shutdownTimeout leaves some of the 30 seconds Heroku gives before it kills
+// the dyno for closing the database.
+const shutdownTimeout = 25 * time.Second
+
 const (
 	envPort             = "PORT"
 	envDeploymentType   = "DEPLOYMENT_TYPE"
@@ -27,6 +43,15 @@ const (
 	envEmailPassword    = "ENV_EMAIL_PASSWORD"
 	envSMTPHost         = "ENV_SMTP_HOST"
 	envSMTPPort         = "ENV_SMTP_PORT"
+	envEventBridge      = "EVENT_BRIDGE"
+	envRateLimit        = "RATE_LIMIT"
+	envRateLimitBurst   = "RATE_LIMIT_BURST"
+	envBannedIPs        = "BANNED_IPS"
+	envTrustedProxies   = "TRUSTED_PROXIES"
+	envBotMode          = "BOT_MODE"
+	envWebhookURL       = "TELEGRAM_WEBHOOK_URL"
+	envWebhookSecret    = "TELEGRAM_WEBHOOK_SECRET"
+	envAutoMigrate      = "AUTO_MIGRATE"
 )
 
 func main() {
@@ -42,7 +67,6 @@ func main() {
 		envPort,
 		envTelegramBotToken,
 		envDatabaseURL,
-		envPwd,
 		envFwensClientURL,
 		envEmail,
 		envEmailPassword,
@@ -53,15 +77,55 @@ func main() {
 		log.Fatal(err)
 	}
 
-	db, err := postgres.Open(config[envDatabaseURL])
+	// The database URL picks where everything is kept, SQLite for a single
+	// instance or Postgres otherwise.
+	databaseURL := config[envDatabaseURL]
+	open := openPostgres
+	if strings.HasPrefix(databaseURL, sqlite.Scheme) {
+		if os.Getenv(envEventBridge) == "postgres" {
+			log.Fatalf("Failed to bridge group events: %s=postgres needs a Postgres database", envEventBridge)
+		}
+		open = openSQLite
+	}
+
+	// The schema is migrated on boot unless it is left to cmd/migrate, e.g.
+	// when the database user may not alter tables.
+	store, err := open(databaseURL, os.Getenv(envAutoMigrate) != "false")
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+	// Deferred first so that the database is closed last, once everything
+	// that uses it has stopped.
+	defer store.db.Close()
 
-	us := &postgres.UserService{DB: db}
-	ms := &postgres.ModuleService{DB: db}
-	gs := &postgres.GroupService{DB: db}
+	// Group events go straight to the bus, or through Postgres when there is
+	// more than one instance so that each of them sees every event.
+	bus := events.NewBus()
+	var publisher modwithfriends.GroupEventPublisher = bus
+	if os.Getenv(envEventBridge) == "postgres" {
+		listener, err := postgres.ListenGroupEvents(databaseURL, bus)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer listener.Close()
+		publisher = &postgres.EventBridge{DB: store.db}
+	}
+
+	// Webhooks are queued and group metrics counted by the instance that made
+	// the change alone, so that they are not done once per instance.
+	ws := store.webhooks
+	dispatcher := webhooks.NewDispatcher(ws)
+	publisher = events.Publishers{publisher, dispatcher, metrics.GroupPublisher{}}
+
+	us := &events.UserService{UserService: store.users, GroupService: store.groups, Publisher: publisher}
+	ms := store.modules
+	gs := &events.GroupService{GroupService: store.groups, Publisher: publisher}
+	bs := store.broadcasts
+	ks := store.apiKeys
+	ss := store.stats
+	as := store.admins
+	is := store.idempotency
+	aus := store.audit
 
 	es := smtp.NewEmailClient(
 		config[envEmail],
@@ -70,23 +134,67 @@ func main() {
 		utils.ToIntOrPanic(config[envSMTPPort]),
 	)
 
-	bot, err := bot.NewBot(config[envTelegramBotToken], bot.NewRoutes(us, ms, gs, es, config[envEmail]))
+	// The bot long polls Telegram unless it is told to take updates through
+	// a webhook on the server.
+	var webhook *bot.Webhook
+	switch mode := os.Getenv(envBotMode); mode {
+	case "", "polling":
+	case "webhook":
+		webhook = &bot.Webhook{
+			PublicURL: os.Getenv(envWebhookURL),
+			Secret:    os.Getenv(envWebhookSecret),
+		}
+	default:
+		log.Fatalf("Failed to parse %s: %q is neither polling nor webhook", envBotMode, mode)
+	}
+
+	bot, err := bot.NewBot(config[envTelegramBotToken], webhook, bot.NewRoutes(us, ms, gs, es, config[envEmail]))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Rate limits are optional, the server falls back to its defaults.
+	rateLimit := http.RateLimit{Banned: strings.Split(os.Getenv(envBannedIPs), ",")}
+	if rate, ok := os.LookupEnv(envRateLimit); ok {
+		rateLimit.Rate, err = strconv.ParseFloat(rate, 64)
+		if err != nil {
+			log.Fatalf("Failed to parse %s: %s", envRateLimit, err)
+		}
+	}
+	if burst, ok := os.LookupEnv(envRateLimitBurst); ok {
+		rateLimit.Burst = utils.ToIntOrPanic(burst)
+	}
+
 	router := gin.Default()
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{config[envFwensClientURL]}
+	corsConfig.ExposeHeaders = []string{"X-Next-Cursor", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
 	router.Use(cors.New(corsConfig))
 
 	server := http.Server{
-		Port:         utils.ToIntOrPanic(config[envPort]),
-		Router:       router,
-		Bot:          bot,
-		UserService:  us,
-		GroupService: gs,
-		Pwd:          config[envPwd],
+		Port:               utils.ToIntOrPanic(config[envPort]),
+		Router:             router,
+		Bot:                bot,
+		TelegramWebhook:    bot.Webhook(),
+		Database:           store.db,
+		Notifier:           notify.Fallback(bot, &notify.Email{EmailService: es, UserService: us}),
+		UserService:        us,
+		GroupService:       gs,
+		ModuleService:      ms,
+		BroadcastService:   bs,
+		EmailService:       es,
+		APIKeyService:      ks,
+		StatsService:       ss,
+		GroupEvents:        bus,
+		WebhookService:     ws,
+		AdminService:       as,
+		IdempotencyService: is,
+		AuditService:       aus,
+		Webhooks:           dispatcher,
+		AdminEmail:         config[envEmail],
+		RateLimit:          rateLimit,
+		TrustedProxies:     strings.Split(os.Getenv(envTrustedProxies), ","),
+		Pwd:                os.Getenv(envPwd),
 	}
 
 	// Prevent Heroku from crashing by binding port to server.
@@ -98,14 +206,112 @@ func main() {
 
 	go bot.Start()
 	log.Println("Bot is running 🤖")
+	if webhook := bot.Webhook(); webhook != nil {
+		log.Println("Bot is taking updates at", webhook.Path())
+	}
+
+	go dispatcher.Start()
+	log.Println("Webhooks are being delivered 🪝")
 
 	go server.Start()
 	log.Println("Server is running 💻")
 
-	// Gracefully shutdown when Heroku issues a SIGTERM due to dyno cycling.
+	// Gracefully shutdown when Heroku issues a SIGTERM due to dyno cycling,
+	// or on Ctrl+C.
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGTERM)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 	s := <-signals
 	log.Println("Gracefully shutting down with signal:", s)
-	os.Exit(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Running broadcasts are cut short as soon as the bot stops, and save who
+	// they have yet to reach while the server finishes their requests.
+	if err := bot.Stop(ctx); err != nil {
+		log.Println(err)
+	}
+	log.Println("Bot has stopped taking updates")
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
+	log.Println("Server has finished serving requests")
+
+	if err := dispatcher.Stop(ctx); err != nil {
+		log.Println(err)
+	}
+	log.Println("Webhooks have stopped being delivered")
+}
+
+// storage holds the services keeping everything in one database.
+type storage struct {
+	db          *sqlx.DB
+	users       modwithfriends.UserService
+	groups      modwithfriends.GroupService
+	modules     modwithfriends.ModuleService
+	broadcasts  modwithfriends.BroadcastService
+	apiKeys     modwithfriends.APIKeyService
+	stats       modwithfriends.StatsService
+	webhooks    modwithfriends.WebhookService
+	admins      modwithfriends.AdminService
+	idempotency modwithfriends.IdempotencyService
+	audit       modwithfriends.AuditService
+}
+
+func openPostgres(databaseURL string, migrate bool) (storage, error) {
+	db, err := postgres.Open(databaseURL)
+	if err != nil {
+		return storage{}, err
+	}
+
+	if migrate {
+		applied, err := postgres.Migrate(db)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			db.Close()
+			return storage{}, err
+		}
+	}
+
+	return sqlStorage(db, postgres.Dialect{}), nil
+}
+
+func openSQLite(databaseURL string, migrate bool) (storage, error) {
+	db, err := sqlite.Open(databaseURL)
+	if err != nil {
+		return storage{}, err
+	}
+
+	if migrate {
+		applied, err := sqlite.Migrate(db)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			db.Close()
+			return storage{}, err
+		}
+	}
+
+	return sqlStorage(db, sqlite.Dialect{}), nil
+}
+
+// sqlStorage keeps everything in db, whose SQL is that of dialect.
+func sqlStorage(db *sqlx.DB, dialect sqlstore.Dialect) storage {
+	return storage{
+		db:          db,
+		users:       &sqlstore.UserService{DB: db, Dialect: dialect},
+		groups:      &sqlstore.GroupService{DB: db, Dialect: dialect},
+		modules:     &sqlstore.ModuleService{DB: db, Dialect: dialect},
+		broadcasts:  &sqlstore.BroadcastService{DB: db},
+		apiKeys:     &sqlstore.APIKeyService{DB: db, Dialect: dialect},
+		stats:       &sqlstore.StatsService{DB: db},
+		webhooks:    &sqlstore.WebhookService{DB: db, Dialect: dialect},
+		admins:      &sqlstore.AdminService{DB: db, Dialect: dialect},
+		idempotency: &sqlstore.IdempotencyService{DB: db},
+		audit:       &sqlstore.AuditService{DB: db},
+	}
 }
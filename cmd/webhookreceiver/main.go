@@ -0,0 +1,49 @@
+// Command webhookreceiver prints the webhook deliveries it receives after
+// checking their signatures, to try webhooks out locally:
+//
+//	go run cmd/webhookreceiver/main.go -secret whsec_... -port 9000
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"modwithfriends/webhooks"
+	"net/http"
+	"time"
+)
+
+func main() {
+	port := flag.Int("port", 9000, "port to listen on")
+	secret := flag.String("secret", "", "secret of the webhook, shown when it was created")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = webhooks.Verify(*secret, r.Header.Get(webhooks.SignatureHeader), body, time.Now())
+		if err != nil {
+			log.Printf("Rejected %s delivery %s: %s", r.Header.Get(webhooks.EventHeader), r.Header.Get(webhooks.DeliveryHeader), err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		pretty := bytes.Buffer{}
+		if err := json.Indent(&pretty, body, "", "  "); err != nil {
+			pretty.Write(body)
+		}
+		log.Printf("Received %s delivery %s:\n%s", r.Header.Get(webhooks.EventHeader), r.Header.Get(webhooks.DeliveryHeader), pretty.String())
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Listening for webhooks on :%d", *port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), nil))
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"modwithfriends"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it starts missing events.
+const subscriberBuffer = 32
+
+// Bus fans out group events to every subscriber within this process.
+type Bus struct {
+	lock        sync.RWMutex
+	subscribers map[chan modwithfriends.GroupEvent]bool
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: map[chan modwithfriends.GroupEvent]bool{},
+	}
+}
+
+// Publish never blocks, a subscriber that is too far behind misses the event
+// rather than holding up the change to the group.
+func (b *Bus) Publish(e modwithfriends.GroupEvent) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of events published from now on, along with a
+// function to stop receiving them which closes the channel.
+func (b *Bus) Subscribe() (<-chan modwithfriends.GroupEvent, func()) {
+	subscriber := make(chan modwithfriends.GroupEvent, subscriberBuffer)
+
+	b.lock.Lock()
+	b.subscribers[subscriber] = true
+	b.lock.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, subscriber)
+			b.lock.Unlock()
+			close(subscriber)
+		})
+	}
+
+	return subscriber, unsubscribe
+}
+
+// Publishers publishes each event to every one of them in turn.
+type Publishers []modwithfriends.GroupEventPublisher
+
+func (ps Publishers) Publish(e modwithfriends.GroupEvent) {
+	for _, p := range ps {
+		p.Publish(e)
+	}
+}
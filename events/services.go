@@ -0,0 +1,234 @@
+package events
+
+import (
+	"log"
+	"modwithfriends"
+)
+
+// GroupService publishes an event for every group it creates, updates or
+// deletes.
+type GroupService struct {
+	modwithfriends.GroupService
+	Publisher modwithfriends.GroupEventPublisher
+}
+
+func (gs *GroupService) CreateGroup(g modwithfriends.Group) (string, error) {
+	groupID, err := gs.GroupService.CreateGroup(g)
+	if err != nil {
+		return "", err
+	}
+
+	gs.publish(modwithfriends.GroupCreated, groupID, nil)
+	return groupID, nil
+}
+
+func (gs *GroupService) UpdateGroup(groupID string, updatedGroup modwithfriends.Group) error {
+	previous, err := gs.GroupService.Group(groupID)
+	if err != nil {
+		return err
+	}
+
+	err = gs.GroupService.UpdateGroup(groupID, updatedGroup)
+	if err != nil {
+		return err
+	}
+
+	gs.publish(modwithfriends.GroupUpdated, groupID, &previous)
+	return nil
+}
+
+func (gs *GroupService) AssignInviteLinks(assignments []modwithfriends.InviteLinkAssignment) error {
+	previous := []modwithfriends.Group{}
+	for _, assignment := range assignments {
+		group, err := gs.GroupService.Group(assignment.GroupID)
+		if err != nil {
+			return err
+		}
+		previous = append(previous, group)
+	}
+
+	err := gs.GroupService.AssignInviteLinks(assignments)
+	if err != nil {
+		return err
+	}
+
+	for i := range previous {
+		gs.publish(modwithfriends.GroupUpdated, previous[i].ID, &previous[i])
+	}
+	return nil
+}
+
+func (gs *GroupService) MoveMember(fromGroupID string, toGroupID string, chatID modwithfriends.ChatID) error {
+	from, err := gs.GroupService.Group(fromGroupID)
+	if err != nil {
+		return err
+	}
+	to, err := gs.GroupService.Group(toGroupID)
+	if err != nil {
+		return err
+	}
+
+	err = gs.GroupService.MoveMember(fromGroupID, toGroupID, chatID)
+	if err != nil {
+		return err
+	}
+
+	if len(from.Members) < 2 {
+		gs.Publisher.Publish(modwithfriends.GroupEvent{Type: modwithfriends.GroupDeleted, Group: from})
+	} else {
+		gs.publish(modwithfriends.GroupUpdated, fromGroupID, &from)
+	}
+	gs.publish(modwithfriends.GroupUpdated, toGroupID, &to)
+	return nil
+}
+
+func (gs *GroupService) MergeGroups(fromGroupID string, intoGroupID string) error {
+	from, err := gs.GroupService.Group(fromGroupID)
+	if err != nil {
+		return err
+	}
+	into, err := gs.GroupService.Group(intoGroupID)
+	if err != nil {
+		return err
+	}
+
+	err = gs.GroupService.MergeGroups(fromGroupID, intoGroupID)
+	if err != nil {
+		return err
+	}
+
+	gs.Publisher.Publish(modwithfriends.GroupEvent{Type: modwithfriends.GroupDeleted, Group: from})
+	gs.publish(modwithfriends.GroupUpdated, intoGroupID, &into)
+	return nil
+}
+
+func (gs *GroupService) DeleteGroup(groupID string) error {
+	group, err := gs.GroupService.Group(groupID)
+	if err != nil {
+		return err
+	}
+
+	err = gs.GroupService.DeleteGroup(groupID)
+	if err != nil {
+		return err
+	}
+
+	gs.Publisher.Publish(modwithfriends.GroupEvent{Type: modwithfriends.GroupDeleted, Group: group})
+	return nil
+}
+
+// publish reads the group back so that the event carries what was saved.
+func (gs *GroupService) publish(eventType modwithfriends.GroupEventType, groupID string, previous *modwithfriends.Group) {
+	group, err := gs.GroupService.Group(groupID)
+	if err != nil {
+		log.Printf("Failed to publish %s event for group %s: %s", eventType, groupID, err)
+		return
+	}
+
+	gs.Publisher.Publish(modwithfriends.GroupEvent{Type: eventType, Group: group, Previous: previous})
+}
+
+// UserService publishes events for the groups a user is taken out of when
+// they are deactivated or deleted, and for the forming groups of the same
+// modules that members are backfilled from.
+type UserService struct {
+	modwithfriends.UserService
+	GroupService modwithfriends.GroupService
+	Publisher    modwithfriends.GroupEventPublisher
+}
+
+func (us *UserService) DeactivateUser(chatID modwithfriends.ChatID) error {
+	return us.withGroupEvents(chatID, us.UserService.DeactivateUser)
+}
+
+func (us *UserService) DeleteUser(chatID modwithfriends.ChatID) error {
+	return us.withGroupEvents(chatID, us.UserService.DeleteUser)
+}
+
+func (us *UserService) withGroupEvents(chatID modwithfriends.ChatID, change func(modwithfriends.ChatID) error) error {
+	groups, err := us.UserService.Groups(chatID)
+	if err != nil {
+		return err
+	}
+
+	donors, err := us.donors(groups)
+	if err != nil {
+		return err
+	}
+
+	err = change(chatID)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range append(groups, donors...) {
+		updatedGroup, err := us.GroupService.Group(group.ID)
+		if err == modwithfriends.ErrEntityNotFound {
+			us.Publisher.Publish(modwithfriends.GroupEvent{Type: modwithfriends.GroupDeleted, Group: group})
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to publish event for group %s: %s", group.ID, err)
+			continue
+		}
+		if !sameMembers(updatedGroup, group) {
+			previous := group
+			us.Publisher.Publish(modwithfriends.GroupEvent{Type: modwithfriends.GroupUpdated, Group: updatedGroup, Previous: &previous})
+		}
+	}
+
+	return nil
+}
+
+// donors returns the other forming groups of the modules of the user's forming
+// groups, any of which may give up a member to backfill a seat the user frees.
+func (us *UserService) donors(groups []modwithfriends.Group) ([]modwithfriends.Group, error) {
+	seen := map[string]bool{}
+	for _, group := range groups {
+		seen[group.ID] = true
+	}
+
+	donors := []modwithfriends.Group{}
+	modules := map[modwithfriends.ModuleCode]bool{}
+	for _, group := range groups {
+		if group.InviteLink != nil || modules[group.ModuleCode] {
+			continue
+		}
+		modules[group.ModuleCode] = true
+
+		moduleCode := group.ModuleCode
+		formingGroups, err := us.GroupService.GroupsBy(modwithfriends.GroupQuery{
+			ModuleCode: &moduleCode,
+			States:     []modwithfriends.GroupState{modwithfriends.GroupStateForming},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, formingGroup := range formingGroups {
+			if !seen[formingGroup.ID] {
+				seen[formingGroup.ID] = true
+				donors = append(donors, formingGroup)
+			}
+		}
+	}
+
+	return donors, nil
+}
+
+func sameMembers(a modwithfriends.Group, b modwithfriends.Group) bool {
+	if len(a.Members) != len(b.Members) {
+		return false
+	}
+
+	members := map[modwithfriends.ChatID]bool{}
+	for _, member := range a.Members {
+		members[member] = true
+	}
+	for _, member := range b.Members {
+		if !members[member] {
+			return false
+		}
+	}
+	return true
+}
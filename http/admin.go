@@ -0,0 +1,490 @@
+package http
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"modwithfriends"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	flashCookie = "mwf_admin_flash"
+
+	// adminGroupsPageSize is how many groups the groups page shows at once.
+	adminGroupsPageSize = 25
+
+	profileTTL = 10 * time.Minute
+	// maxCachedProfiles caps how many profiles are remembered, the expired
+	// ones going first once it is reached.
+	maxCachedProfiles = 1000
+	// maxProfileFetches caps how many profiles are fetched from Telegram at
+	// once.
+	maxProfileFetches = 8
+)
+
+//go:embed templates/admin/*.html
+var adminTemplateFS embed.FS
+
+// adminTemplates holds each page parsed along with the layout, so that every
+// page can fill in the layout's blocks its own way.
+var adminTemplates = parseAdminTemplates("login.html", "groups.html", "broadcast.html", "error.html")
+
+func parseAdminTemplates(pages ...string) map[string]*template.Template {
+	templates := map[string]*template.Template{}
+	for _, page := range pages {
+		templates[page] = template.Must(template.ParseFS(
+			adminTemplateFS,
+			"templates/admin/layout.html",
+			"templates/admin/nav.html",
+			path.Join("templates/admin", page),
+		))
+	}
+	return templates
+}
+
+// adminPage is what every page behind the login shows around its content.
+type adminPage struct {
+	Admin modwithfriends.Admin
+	CSRF  string
+	Flash string
+}
+
+type groupsPage struct {
+	adminPage
+	Groups []adminGroup
+	// NextCursor is where the next page of groups starts, if there may be one.
+	NextCursor string
+}
+
+type adminGroup struct {
+	modwithfriends.Group
+	Full    bool
+	Members []adminMember
+	// MergeCandidates are the groups of the same module that have room for
+	// all of this group's members.
+	MergeCandidates []modwithfriends.Group
+}
+
+type adminMember struct {
+	ChatID  modwithfriends.ChatID
+	Profile *modwithfriends.Profile
+	Email   *string
+}
+
+type broadcastPage struct {
+	adminPage
+	Message string
+	Error   string
+	Result  *broadcastResponse
+}
+
+type errorPage struct {
+	Message   string
+	RequestID string
+}
+
+type cachedProfile struct {
+	profile   *modwithfriends.Profile
+	fetchedAt time.Time
+}
+
+// adminHandler serves the dashboard that admins use to look after groups and
+// send broadcasts without going through the API.
+type adminHandler struct {
+	Router       *gin.Engine
+	AdminService modwithfriends.AdminService
+	GroupService modwithfriends.GroupService
+	UserService  modwithfriends.UserService
+	Bot          modwithfriends.Bot
+	Broadcaster  *broadcaster
+	Audit        *auditor
+
+	profilesMu   sync.Mutex
+	profileCache map[modwithfriends.ChatID]cachedProfile
+}
+
+func (ah *adminHandler) register() {
+	ah.profileCache = map[modwithfriends.ChatID]cachedProfile{}
+
+	admin := ah.Router.Group("/admin", withAdminHeaders)
+
+	admin.GET("/login", ah.getLogin)
+	admin.POST("/login", ah.login)
+
+	authed := admin.Group("/", ah.requireAdmin)
+
+	authed.POST("/logout", ah.logout)
+	authed.GET("/", ah.getGroups)
+	authed.POST("/groups/:groupID/invite-link", ah.setInviteLink)
+	authed.POST("/groups/:groupID/dissolve", ah.dissolveGroup)
+	authed.POST("/groups/:groupID/merge", ah.mergeGroup)
+	authed.GET("/broadcast", ah.getBroadcast)
+	authed.POST("/broadcast", ah.broadcast)
+}
+
+// getGroups lists the groups that have yet to be issued an invite link, full
+// ones first, a page at a time.
+func (ah *adminHandler) getGroups(c *gin.Context) {
+	query := modwithfriends.GroupQuery{
+		States:     []modwithfriends.GroupState{modwithfriends.GroupStateFull, modwithfriends.GroupStateForming},
+		SortBy:     modwithfriends.SortBySize,
+		Descending: true,
+		Limit:      adminGroupsPageSize,
+	}
+	if cursorQuery, exist := c.GetQuery("cursor"); exist {
+		cursor, err := decodeCursor(cursorQuery)
+		if err != nil || cursor.SortBy != query.SortBy || cursor.Descending != query.Descending {
+			ah.renderError(c, errInvalidCursor)
+			return
+		}
+		query.After = &cursor.GroupCursor
+	}
+
+	groups, err := ah.GroupService.GroupsBy(query)
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+
+	// Any forming group on any page may be merged into, so they are all
+	// looked up, but without their members' details.
+	forming, err := ah.GroupService.GroupsBy(modwithfriends.GroupQuery{
+		States: []modwithfriends.GroupState{modwithfriends.GroupStateForming},
+	})
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+
+	byModule := map[modwithfriends.ModuleCode][]modwithfriends.Group{}
+	for _, group := range forming {
+		byModule[group.ModuleCode] = append(byModule[group.ModuleCode], group)
+	}
+
+	chatIDs := []modwithfriends.ChatID{}
+	for _, group := range groups {
+		chatIDs = append(chatIDs, group.Members...)
+	}
+
+	emails, err := ah.UserService.Emails(chatIDs)
+	if err != nil {
+		log.Printf("[%s] %s", requestID(c), err)
+	}
+	profiles := ah.profiles(c, chatIDs)
+
+	page := groupsPage{adminPage: ah.page(c), Groups: []adminGroup{}}
+	for _, group := range groups {
+		members := []adminMember{}
+		for _, chatID := range group.Members {
+			member := adminMember{ChatID: chatID, Profile: profiles[chatID]}
+			if email, ok := emails[chatID]; ok {
+				member.Email = &email
+			}
+			members = append(members, member)
+		}
+
+		candidates := []modwithfriends.Group{}
+		for _, other := range byModule[group.ModuleCode] {
+			if other.ID != group.ID && len(other.Members)+len(group.Members) <= modwithfriends.GroupSize {
+				candidates = append(candidates, other)
+			}
+		}
+
+		page.Groups = append(page.Groups, adminGroup{
+			Group:           group,
+			Full:            len(group.Members) >= modwithfriends.GroupSize,
+			Members:         members,
+			MergeCandidates: candidates,
+		})
+	}
+
+	if len(groups) == query.Limit {
+		page.NextCursor, err = encodeCursor(pageCursor{
+			SortBy:      query.SortBy,
+			Descending:  query.Descending,
+			GroupCursor: modwithfriends.NewGroupCursor(groups[len(groups)-1]),
+		})
+		if err != nil {
+			log.Printf("[%s] %s", requestID(c), err)
+		}
+	}
+
+	render(c, http.StatusOK, "groups.html", page)
+}
+
+// setInviteLink issues the group its invite link and tells its members, just
+// like the v0 PATCH endpoint.
+func (ah *adminHandler) setInviteLink(c *gin.Context) {
+	group, ok := ah.pendingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	inviteLink, err := parseInviteLink(c.PostForm("inviteLink"))
+	if err != nil {
+		ah.redirectWithFlash(c, "/admin/", errInvalidInviteLink.Message)
+		return
+	}
+	previous := copyGroup(group)
+	group.InviteLink = &inviteLink
+
+	err = ah.GroupService.UpdateGroup(group.ID, group)
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+	ah.Audit.record(c, modwithfriends.AuditGroupInviteLink, group.ID, previous, group)
+
+	res := ah.Broadcaster.notifyInviteLink(group)
+
+	flash := fmt.Sprintf("Sent the %s invite link to %d of %d members", group.ModuleCode, len(group.Members)-len(res.FailedToReach), len(group.Members))
+	if len(res.FailedToReach) > 0 || len(res.Errors) > 0 {
+		flash += fmt.Sprintf(", see broadcast %s for who was missed", res.BroadcastID)
+	}
+	ah.redirectWithFlash(c, "/admin/", flash)
+}
+
+func (ah *adminHandler) dissolveGroup(c *gin.Context) {
+	group, ok := ah.pendingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	err := ah.GroupService.DeleteGroup(group.ID)
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+	ah.Audit.record(c, modwithfriends.AuditGroupDelete, group.ID, group, nil)
+
+	ah.redirectWithFlash(c, "/admin/", fmt.Sprintf("Dissolved a %s group of %d", group.ModuleCode, len(group.Members)))
+}
+
+// mergeGroup moves every member of the group into another group of the same
+// module and dissolves the group.
+func (ah *adminHandler) mergeGroup(c *gin.Context) {
+	from, ok := ah.pendingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	into, ok := ah.pendingGroup(c, c.PostForm("into"))
+	if !ok {
+		return
+	}
+
+	switch {
+	case into.ID == from.ID:
+		ah.redirectWithFlash(c, "/admin/", "A group cannot be merged into itself")
+		return
+	case into.ModuleCode != from.ModuleCode:
+		ah.redirectWithFlash(c, "/admin/", "Only groups of the same module can be merged")
+		return
+	case len(into.Members)+len(from.Members) > modwithfriends.GroupSize:
+		ah.redirectWithFlash(c, "/admin/", fmt.Sprintf("The groups have more than %d members between them", modwithfriends.GroupSize))
+		return
+	}
+
+	before := groupTransfer{From: &from, To: copyGroup(into)}
+
+	err := ah.GroupService.MergeGroups(from.ID, into.ID)
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+
+	into, err = ah.GroupService.Group(into.ID)
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+	ah.Audit.record(c, modwithfriends.AuditGroupMerge, from.ID, before, groupTransfer{To: into})
+
+	ah.redirectWithFlash(c, "/admin/", fmt.Sprintf("Merged the %s groups, the group now has %d members", into.ModuleCode, len(into.Members)))
+}
+
+func (ah *adminHandler) getBroadcast(c *gin.Context) {
+	render(c, http.StatusOK, "broadcast.html", broadcastPage{adminPage: ah.page(c)})
+}
+
+func (ah *adminHandler) broadcast(c *gin.Context) {
+	page := broadcastPage{adminPage: ah.page(c), Message: c.PostForm("message")}
+
+	tmpl, err := modwithfriends.NewMessageTemplate(page.Message)
+	if err != nil {
+		page.Error = err.Error()
+		render(c, http.StatusBadRequest, "broadcast.html", page)
+		return
+	}
+
+	res, err := ah.Broadcaster.broadcastToAll(page.Message, tmpl)
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+	ah.Audit.record(c, modwithfriends.AuditBroadcastSend, res.BroadcastID, nil, broadcastSnapshot{res.BroadcastID, page.Message, res.FailedToReach})
+
+	page.Message = ""
+	page.Result = &res
+	render(c, http.StatusOK, "broadcast.html", page)
+}
+
+// pendingGroup renders an error page unless groupID is a valid ID of a group
+// that has yet to be issued an invite link.
+func (ah *adminHandler) pendingGroup(c *gin.Context, groupID string) (modwithfriends.Group, bool) {
+	groupID, err := parseGroupID(groupID)
+	if err != nil {
+		ah.renderError(c, err)
+		return modwithfriends.Group{}, false
+	}
+
+	group, err := ah.GroupService.Group(groupID)
+	if err != nil {
+		ah.renderError(c, err)
+		return modwithfriends.Group{}, false
+	}
+
+	if group.InviteLink != nil {
+		ah.redirectWithFlash(c, "/admin/", fmt.Sprintf("The %s group has already been issued an invite link", group.ModuleCode))
+		return modwithfriends.Group{}, false
+	}
+
+	return group, true
+}
+
+// profiles looks up the users' Telegram profiles, a few at a time, leaving out
+// those that could not be fetched.
+func (ah *adminHandler) profiles(c *gin.Context, chatIDs []modwithfriends.ChatID) map[modwithfriends.ChatID]*modwithfriends.Profile {
+	profiles := map[modwithfriends.ChatID]*modwithfriends.Profile{}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	fetches := make(chan struct{}, maxProfileFetches)
+
+	for _, chatID := range chatIDs {
+		wg.Add(1)
+		fetches <- struct{}{}
+
+		go func(chatID modwithfriends.ChatID) {
+			defer func() {
+				<-fetches
+				wg.Done()
+			}()
+
+			profile := ah.profile(c, chatID)
+			mu.Lock()
+			profiles[chatID] = profile
+			mu.Unlock()
+		}(chatID)
+	}
+
+	wg.Wait()
+	return profiles
+}
+
+// profile looks up the user's Telegram profile, remembering it for a while so
+// that the groups page does not hit Telegram for every member on every visit.
+func (ah *adminHandler) profile(c *gin.Context, chatID modwithfriends.ChatID) *modwithfriends.Profile {
+	ah.profilesMu.Lock()
+	cached, ok := ah.profileCache[chatID]
+	ah.profilesMu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < profileTTL {
+		return cached.profile
+	}
+
+	var profile *modwithfriends.Profile
+	p, err := ah.Bot.Profile(chatID)
+	if err != nil {
+		log.Printf("[%s] %s", requestID(c), err)
+	} else {
+		profile = &p
+	}
+
+	ah.profilesMu.Lock()
+	ah.cacheProfile(chatID, cachedProfile{profile: profile, fetchedAt: time.Now()})
+	ah.profilesMu.Unlock()
+
+	return profile
+}
+
+// cacheProfile remembers the profile, making room for it if the cache is full
+// by forgetting the expired profiles, or any profile if none has expired. It
+// must be called with profilesMu held.
+func (ah *adminHandler) cacheProfile(chatID modwithfriends.ChatID, cached cachedProfile) {
+	if _, ok := ah.profileCache[chatID]; !ok && len(ah.profileCache) >= maxCachedProfiles {
+		for id, other := range ah.profileCache {
+			if time.Since(other.fetchedAt) >= profileTTL {
+				delete(ah.profileCache, id)
+			}
+		}
+		for id := range ah.profileCache {
+			if len(ah.profileCache) < maxCachedProfiles {
+				break
+			}
+			delete(ah.profileCache, id)
+		}
+	}
+
+	ah.profileCache[chatID] = cached
+}
+
+// page fills in what every page shows, taking the flash message left by the
+// previous request.
+func (ah *adminHandler) page(c *gin.Context) adminPage {
+	page := adminPage{
+		Admin: c.MustGet(adminContext).(modwithfriends.Admin),
+		CSRF:  c.GetString(csrfContext),
+	}
+
+	if flash, err := c.Cookie(flashCookie); err == nil {
+		page.Flash, _ = url.QueryUnescape(flash)
+		setAdminCookie(c, flashCookie, "", -1)
+	}
+
+	return page
+}
+
+func (ah *adminHandler) redirectWithFlash(c *gin.Context, location string, flash string) {
+	setAdminCookie(c, flashCookie, url.QueryEscape(flash), 60)
+	c.Redirect(http.StatusSeeOther, location)
+}
+
+// renderError shows an error page, hiding errors that are not known behind a
+// generic message like the API does.
+func (ah *adminHandler) renderError(c *gin.Context, err error) {
+	apiErr := toAPIError(c, err)
+
+	message := apiErr.Message
+	if errors.Is(err, modwithfriends.ErrEntityNotFound) {
+		message = "The group no longer exists, it may have been changed by someone else"
+	}
+
+	render(c, apiErr.Status, "error.html", errorPage{
+		Message:   message,
+		RequestID: requestID(c),
+	})
+}
+
+// render executes the page into a buffer first, so that a broken template
+// does not leave a half written page.
+func render(c *gin.Context, status int, name string, data interface{}) {
+	buf := bytes.Buffer{}
+	err := adminTemplates[name].ExecuteTemplate(&buf, "layout", data)
+	if err != nil {
+		log.Printf("[%s] Failed to render %s: %s", requestID(c), name, err)
+		c.String(http.StatusInternalServerError, "Failed to render the page")
+		return
+	}
+
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"modwithfriends"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookie   = "mwf_admin_session"
+	sessionDuration = 12 * time.Hour
+	adminContext    = "admin"
+	csrfContext     = "csrf"
+	csrfField       = "csrf"
+)
+
+// dummyPasswordHash is compared against when there is no such admin, so that
+// a login takes as long whether or not the username exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("modwithfriends"), bcrypt.DefaultCost)
+
+type loginPage struct {
+	Username string
+	Error    string
+}
+
+func (ah *adminHandler) getLogin(c *gin.Context) {
+	render(c, http.StatusOK, "login.html", loginPage{})
+}
+
+func (ah *adminHandler) login(c *gin.Context) {
+	username := c.PostForm("username")
+	password := c.PostForm("password")
+
+	admin, err := ah.AdminService.AdminByUsername(username)
+	if err != nil && err != modwithfriends.ErrEntityNotFound {
+		ah.renderError(c, err)
+		return
+	}
+
+	hash := dummyPasswordHash
+	if err == nil {
+		hash = []byte(admin.PasswordHash)
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil {
+		log.Printf("[%s] Failed admin login for %q from %s", requestID(c), username, clientIP(c))
+		render(c, http.StatusUnauthorized, "login.html", loginPage{
+			Username: username,
+			Error:    "Wrong username or password",
+		})
+		return
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(sessionDuration)
+	err = ah.AdminService.CreateSession(modwithfriends.AdminSession{
+		TokenHash: hashSessionToken(token),
+		AdminID:   admin.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		ah.renderError(c, err)
+		return
+	}
+
+	setAdminCookie(c, sessionCookie, token, int(sessionDuration.Seconds()))
+	c.Redirect(http.StatusSeeOther, "/admin/")
+}
+
+func (ah *adminHandler) logout(c *gin.Context) {
+	if token, err := c.Cookie(sessionCookie); err == nil {
+		err := ah.AdminService.DeleteSession(hashSessionToken(token))
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	setAdminCookie(c, sessionCookie, "", -1)
+	c.Redirect(http.StatusSeeOther, "/admin/login")
+}
+
+// requireAdmin sends visitors who are not signed in to the login page, and
+// rejects forms that do not carry the CSRF token of the session.
+func (ah *adminHandler) requireAdmin(c *gin.Context) {
+	token, err := c.Cookie(sessionCookie)
+	if err != nil {
+		c.Redirect(http.StatusSeeOther, "/admin/login")
+		c.Abort()
+		return
+	}
+
+	session, err := ah.AdminService.Session(hashSessionToken(token))
+	if err == modwithfriends.ErrEntityNotFound {
+		setAdminCookie(c, sessionCookie, "", -1)
+		c.Redirect(http.StatusSeeOther, "/admin/login")
+		c.Abort()
+		return
+	}
+	if err != nil {
+		ah.renderError(c, err)
+		c.Abort()
+		return
+	}
+
+	admin, err := ah.AdminService.Admin(session.AdminID)
+	if err != nil {
+		ah.renderError(c, err)
+		c.Abort()
+		return
+	}
+
+	csrf := csrfToken(token)
+	if c.Request.Method == http.MethodPost && !hmac.Equal([]byte(c.PostForm(csrfField)), []byte(csrf)) {
+		c.String(http.StatusForbidden, "The form has expired, please go back and try again")
+		c.Abort()
+		return
+	}
+
+	c.Set(adminContext, admin)
+	c.Set(csrfContext, csrf)
+	c.Next()
+}
+
+// withAdminHeaders keeps the dashboard out of frames and caches.
+func withAdminHeaders(c *gin.Context) {
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Cache-Control", "no-store")
+	c.Next()
+}
+
+// setAdminCookie sets a cookie for the dashboard, a negative maxAge in seconds
+// deletes it.
+func setAdminCookie(c *gin.Context, name string, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/admin",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Failed to generate session token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// csrfToken is derived from the session token, so it needs not be stored and
+// cannot be worked out by other sites.
+func csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"modwithfriends"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidAuditCursor = invalidRequest("Please provide a cursor returned by a previous request")
+
+// auditor records the administrative actions taken through the API and the
+// dashboard. Failing to record an action is logged rather than failing the
+// request, as the action has already been taken by then.
+type auditor struct {
+	AuditService modwithfriends.AuditService
+}
+
+// record saves the action along with snapshots of the entity before and after
+// it, either of which is nil when there is no entity to speak of.
+func (a *auditor) record(c *gin.Context, action modwithfriends.AuditAction, entityID string, before interface{}, after interface{}) {
+	entry := modwithfriends.AuditEntry{
+		Actor:      actor(c),
+		Action:     action,
+		EntityType: action.EntityType(),
+		EntityID:   entityID,
+	}
+
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		log.Printf("[%s] %s", requestID(c), err)
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		log.Printf("[%s] %s", requestID(c), err)
+	}
+
+	if err := a.AuditService.Record(entry); err != nil {
+		log.Printf("[%s] Failed to record %s of %s: %s", requestID(c), action, entityID, err)
+	}
+}
+
+// actor names whoever made the request, the API key or the admin signed in
+// to the dashboard.
+func actor(c *gin.Context) string {
+	if admin, ok := c.Get(adminContext); ok {
+		return "admin:" + admin.(modwithfriends.Admin).Username
+	}
+
+	if key, ok := c.Get(apiKeyContext); ok {
+		if key := key.(modwithfriends.APIKey); key.ID != "" {
+			return "api_key:" + key.ID
+		}
+		return "password"
+	}
+
+	return "unknown"
+}
+
+// broadcastSnapshot is what is recorded of a broadcast, the users it has yet
+// to reach rather than how the request went.
+type broadcastSnapshot struct {
+	BroadcastID   string                            `json:"broadcastId"`
+	Message       string                            `json:"message"`
+	FailedToReach []modwithfriends.BroadcastFailure `json:"failedToReach"`
+}
+
+func snapshot(entity interface{}) (json.RawMessage, error) {
+	if entity == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type auditHandler struct {
+	Router       *gin.Engine
+	Auth         *authenticator
+	AuditService modwithfriends.AuditService
+}
+
+func (ah *auditHandler) register() {
+	v0 := ah.Router.Group("/api/v0/audit", ah.Auth.require(modwithfriends.ScopeAuditRead))
+
+	v0.GET("/", ah.getEntries)
+}
+
+// getEntries lists the audit log newest first, filtered by the actor, action,
+// entityType and entityId queries.
+func (ah *auditHandler) getEntries(c *gin.Context) {
+	query, err := parseAuditQuery(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	entries, err := ah.AuditService.Entries(query)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if len(entries) == query.Limit {
+		c.Header(nextCursorHeader, entries[len(entries)-1].ID)
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func parseAuditQuery(c *gin.Context) (modwithfriends.AuditQuery, error) {
+	query := modwithfriends.AuditQuery{Limit: defaultPageLimit}
+
+	if actor, exist := c.GetQuery("actor"); exist {
+		query.Actor = &actor
+	}
+	if action, exist := c.GetQuery("action"); exist {
+		auditAction := modwithfriends.AuditAction(action)
+		query.Action = &auditAction
+	}
+	if entityType, exist := c.GetQuery("entityType"); exist {
+		query.EntityType = &entityType
+	}
+	if entityID, exist := c.GetQuery("entityId"); exist {
+		query.EntityID = &entityID
+	}
+
+	if limitQuery, exist := c.GetQuery("limit"); exist {
+		limit, err := strconv.Atoi(limitQuery)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return modwithfriends.AuditQuery{}, errInvalidLimit
+		}
+		query.Limit = limit
+	}
+
+	if cursor, exist := c.GetQuery("cursor"); exist {
+		if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+			return modwithfriends.AuditQuery{}, errInvalidAuditCursor
+		}
+		query.Before = &cursor
+	}
+
+	return query, nil
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"modwithfriends"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	hackyAuthHeader = "X-LMAO-OOPS"
+	apiKeyPrefix    = "mwf_"
+	apiKeyContext   = "apiKey"
+)
+
+// authenticator checks requests for an API key bearing the required scopes.
+// The shared password, unless it is unset, is accepted as a key with every
+// scope but keys:admin, which it only has while no valid key has it, so that
+// the first API key can be issued.
+type authenticator struct {
+	APIKeyService modwithfriends.APIKeyService
+	Pwd           string
+}
+
+func (a *authenticator) require(scopes ...modwithfriends.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := a.authenticate(c)
+		if !ok {
+			abortWithError(c, &apiError{http.StatusUnauthorized, codeUnauthorized, "Please provide a valid API key"})
+			return
+		}
+
+		for _, scope := range scopes {
+			if !key.HasScope(scope) {
+				abortWithError(c, &apiError{http.StatusForbidden, codeForbidden, fmt.Sprintf("API key is missing the %s scope", scope)})
+				return
+			}
+		}
+
+		c.Set(apiKeyContext, key)
+		c.Next()
+	}
+}
+
+func (a *authenticator) authenticate(c *gin.Context) (modwithfriends.APIKey, bool) {
+	if a.Pwd != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader(hackyAuthHeader)), []byte(a.Pwd)) == 1 {
+		return a.passwordKey(), true
+	}
+
+	secret := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return modwithfriends.APIKey{}, false
+	}
+
+	key, err := a.APIKeyService.APIKeyByHash(hashAPIKey(secret))
+	if err != nil {
+		if err != modwithfriends.ErrEntityNotFound {
+			log.Println(err)
+		}
+		return modwithfriends.APIKey{}, false
+	}
+
+	return key, key.Valid(time.Now())
+}
+
+// passwordKey is the key the shared password stands for. It has no ID, which
+// tells it apart from the keys issued.
+func (a *authenticator) passwordKey() modwithfriends.APIKey {
+	key := modwithfriends.APIKey{Name: "root"}
+	for _, scope := range modwithfriends.AllScopes {
+		if scope != modwithfriends.ScopeKeysAdmin {
+			key.Scopes = append(key.Scopes, scope)
+		}
+	}
+
+	keys, err := a.APIKeyService.APIKeys()
+	if err != nil {
+		log.Println(err)
+		return key
+	}
+
+	now := time.Now()
+	for _, k := range keys {
+		if k.Valid(now) && k.HasScope(modwithfriends.ScopeKeysAdmin) {
+			return key
+		}
+	}
+
+	key.Scopes = append(key.Scopes, modwithfriends.ScopeKeysAdmin)
+	return key
+}
+
+// generateAPIKey returns a new random API key along with the prefix it is
+// identified by.
+func generateAPIKey() (string, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("Failed to generate api key: %w", err)
+	}
+
+	secret := apiKeyPrefix + hex.EncodeToString(b)
+	return secret, secret[:len(apiKeyPrefix)+8], nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
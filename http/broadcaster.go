@@ -0,0 +1,255 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"modwithfriends"
+	"modwithfriends/bot"
+	"modwithfriends/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+var broadcastRate = &modwithfriends.BroadcastRate{
+	Rate:  20,
+	Delay: 1 * time.Second,
+}
+
+// broadcastIDHeader names the broadcast a response sent, for endpoints that
+// respond with something other than a broadcastResponse.
+const broadcastIDHeader = "X-Broadcast-Id"
+
+var errRetryInProgress = conflict("A retry of this broadcast is already in progress")
+
+type broadcastResponse struct {
+	Message       string                            `json:"message"`
+	BroadcastID   string                            `json:"broadcastId,omitempty"`
+	Recovered     []modwithfriends.ChatID           `json:"recovered,omitempty"`
+	Skipped       []modwithfriends.ChatID           `json:"skipped,omitempty"`
+	FailedToReach []modwithfriends.BroadcastFailure `json:"failedToReach"`
+	Errors        []string                          `json:"errors"`
+}
+
+// broadcaster sends broadcasts and takes care of what follows: deactivating
+// users who blocked the bot, saving failures for retries and alerting the
+// admin of failures that need attention.
+type broadcaster struct {
+	Bot              modwithfriends.Bot
+	Notifier         modwithfriends.Notifier
+	UserService      modwithfriends.UserService
+	BroadcastService modwithfriends.BroadcastService
+	EmailService     modwithfriends.EmailService
+	AdminEmail       string
+
+	// retrying holds the IDs of the broadcasts being retried, so that a
+	// broadcast is not retried twice at once.
+	retrying sync.Map
+}
+
+// broadcastToAll sends the message, filled in for each user, to every active
+// user.
+func (b *broadcaster) broadcastToAll(message string, tmpl *modwithfriends.MessageTemplate) (broadcastResponse, error) {
+	users, err := b.UserService.Users()
+	if err != nil {
+		return broadcastResponse{}, err
+	}
+
+	broadcastFailures := b.Bot.BroadcastTemplate(users, tmpl, broadcastRate)
+
+	return b.record(modwithfriends.Broadcast{
+		Message:  message,
+		Failures: broadcastFailures,
+	}, len(users)), nil
+}
+
+// notifyInviteLink tells the group's members that their invite link is ready.
+func (b *broadcaster) notifyInviteLink(group modwithfriends.Group) broadcastResponse {
+	notification := modwithfriends.Notification{
+		Subject: fmt.Sprintf("Your %s mod group is ready", group.ModuleCode),
+		Message: fmt.Sprintf("Your mod group for %s is ready at: %s", group.ModuleCode, *group.InviteLink),
+	}
+
+	broadcastFailures := notifyAll(b.Notifier, group.Members, notification)
+
+	return b.record(modwithfriends.Broadcast{
+		Subject:  &notification.Subject,
+		Message:  notification.Message,
+		Failures: broadcastFailures,
+	}, len(group.Members))
+}
+
+// retry re-sends a broadcast to the users it has yet to reach, returning the
+// broadcast as it was before. Users who have been deactivated since are
+// skipped, keeping their failures for a later retry should they come back.
+func (b *broadcaster) retry(broadcastID string) (modwithfriends.Broadcast, broadcastResponse, error) {
+	if _, inProgress := b.retrying.LoadOrStore(broadcastID, true); inProgress {
+		return modwithfriends.Broadcast{}, broadcastResponse{}, errRetryInProgress
+	}
+	defer b.retrying.Delete(broadcastID)
+
+	// The broadcast is read once no other retry can change it, so that users
+	// reached by a retry that just finished are not sent it again.
+	broadcast, err := b.BroadcastService.Broadcast(broadcastID)
+	if err != nil {
+		return modwithfriends.Broadcast{}, broadcastResponse{}, err
+	}
+
+	res, err := b.retryFailures(broadcast)
+	return broadcast, res, err
+}
+
+func (b *broadcaster) retryFailures(broadcast modwithfriends.Broadcast) (broadcastResponse, error) {
+	activeUsers, err := b.UserService.Users()
+	if err != nil {
+		return broadcastResponse{}, err
+	}
+
+	active := map[modwithfriends.ChatID]bool{}
+	for _, user := range activeUsers {
+		active[user] = true
+	}
+
+	users := []modwithfriends.ChatID{}
+	skipped := []modwithfriends.ChatID{}
+	skippedFailures := []modwithfriends.BroadcastFailure{}
+	for _, failure := range broadcast.Failures {
+		if active[failure.User] {
+			users = append(users, failure.User)
+		} else {
+			skipped = append(skipped, failure.User)
+			skippedFailures = append(skippedFailures, failure)
+		}
+	}
+
+	var broadcastFailures []modwithfriends.BroadcastFailure
+	if broadcast.Subject != nil {
+		broadcastFailures = notifyAll(b.Notifier, users, modwithfriends.Notification{
+			Subject: *broadcast.Subject,
+			Message: broadcast.Message,
+		})
+	} else {
+		tmpl, err := modwithfriends.NewMessageTemplate(broadcast.Message)
+		if err != nil {
+			return broadcastResponse{}, err
+		}
+		broadcastFailures = b.Bot.BroadcastTemplate(users, tmpl, broadcastRate)
+	}
+
+	metrics.CountBroadcast(len(users), broadcastFailures)
+
+	failedUsers := map[modwithfriends.ChatID]bool{}
+	for _, failure := range broadcastFailures {
+		failedUsers[failure.User] = true
+	}
+
+	recovered := []modwithfriends.ChatID{}
+	for _, user := range users {
+		if !failedUsers[user] {
+			recovered = append(recovered, user)
+		}
+	}
+
+	errs := deactivateUsers(b.UserService, broadcastFailures)
+
+	err = b.BroadcastService.UpdateFailures(broadcast.ID, append(broadcastFailures, skippedFailures...))
+	if err != nil {
+		log.Println(err)
+		errs = append(errs, "Failed to save broadcast's remaining failures: "+err.Error())
+	}
+
+	errs = append(errs, alertAdmin(b.EmailService, b.AdminEmail, broadcast.ID, broadcastFailures)...)
+
+	return broadcastResponse{
+		BroadcastID:   broadcast.ID,
+		Recovered:     recovered,
+		Skipped:       skipped,
+		FailedToReach: broadcastFailures,
+		Errors:        errs,
+	}, nil
+}
+
+// record follows up on a broadcast that has just been sent to the given
+// number of recipients.
+func (b *broadcaster) record(broadcast modwithfriends.Broadcast, recipients int) broadcastResponse {
+	metrics.CountBroadcast(recipients, broadcast.Failures)
+
+	errs := deactivateUsers(b.UserService, broadcast.Failures)
+
+	broadcastID, err := b.BroadcastService.CreateBroadcast(broadcast)
+	if err != nil {
+		log.Println(err)
+		errs = append(errs, "Failed to save broadcast for retries: "+err.Error())
+	}
+
+	errs = append(errs, alertAdmin(b.EmailService, b.AdminEmail, broadcastID, broadcast.Failures)...)
+
+	return broadcastResponse{
+		BroadcastID:   broadcastID,
+		FailedToReach: broadcast.Failures,
+		Errors:        errs,
+	}
+}
+
+func notifyAll(notifier modwithfriends.Notifier, users []modwithfriends.ChatID, n modwithfriends.Notification) []modwithfriends.BroadcastFailure {
+	failures := []modwithfriends.BroadcastFailure{}
+
+	for _, user := range users {
+		err := notifier.Notify(user, n)
+		if err != nil {
+			failures = append(failures, modwithfriends.BroadcastFailure{
+				User:         user,
+				Reason:       err,
+				ReasonString: err.Error(),
+				Code:         string(bot.ErrorCodeOf(err)),
+			})
+		}
+	}
+
+	return failures
+}
+
+// deactivateUsers marks users who have blocked the bot as inactive, freeing
+// up their seats in forming groups for others.
+func deactivateUsers(us modwithfriends.UserService, failures []modwithfriends.BroadcastFailure) []string {
+	deactivationErrors := []string{}
+
+	for _, failure := range failures {
+		if errors.Is(failure.Reason, bot.ErrUserDeactivated) {
+			err := us.DeactivateUser(failure.User)
+			if err != nil {
+				deactivationErrors = append(deactivationErrors, fmt.Sprintf("Failed to deactivate user %d: %s", failure.User, err.Error()))
+			}
+		}
+	}
+
+	return deactivationErrors
+}
+
+// alertAdmin emails the admin about failures that are neither the user's doing
+// nor likely to go away by retrying, e.g. a revoked bot token or a bad message.
+func alertAdmin(es modwithfriends.EmailService, adminEmail string, broadcastID string, failures []modwithfriends.BroadcastFailure) []string {
+	alerts := []string{}
+	for _, failure := range failures {
+		var sendErr *bot.SendError
+		if errors.As(failure.Reason, &sendErr) && sendErr.Action != bot.ActionAlert {
+			continue
+		}
+		alerts = append(alerts, fmt.Sprintf("User %d: [%s] %s", failure.User, failure.Code, failure.ReasonString))
+	}
+
+	if len(alerts) == 0 {
+		return []string{}
+	}
+
+	err := es.Send(
+		fmt.Sprintf("[Broadcast Alert] %d failures need attention", len(alerts)),
+		[]string{adminEmail},
+		fmt.Sprintf("BroadcastID: %s\n%s", broadcastID, strings.Join(alerts, "\n")),
+	)
+	if err != nil {
+		return []string{"Failed to alert admin of broadcast failures: " + err.Error()}
+	}
+	return []string{}
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"modwithfriends"
+	"modwithfriends/inmem"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type fakeBroadcasts struct {
+	mu        sync.Mutex
+	broadcast modwithfriends.Broadcast
+}
+
+func (fb *fakeBroadcasts) Broadcast(broadcastID string) (modwithfriends.Broadcast, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if broadcastID != fb.broadcast.ID {
+		return modwithfriends.Broadcast{}, modwithfriends.ErrEntityNotFound
+	}
+	return fb.broadcast, nil
+}
+
+func (fb *fakeBroadcasts) CreateBroadcast(b modwithfriends.Broadcast) (string, error) {
+	panic("not used")
+}
+
+func (fb *fakeBroadcasts) UpdateFailures(broadcastID string, failures []modwithfriends.BroadcastFailure) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.broadcast.Failures = failures
+	return nil
+}
+
+// blockingNotifier notifies everyone, waiting to be released after each
+// notification it starts.
+type blockingNotifier struct {
+	started  chan modwithfriends.ChatID
+	released chan struct{}
+}
+
+func (bn *blockingNotifier) Notify(chatID modwithfriends.ChatID, n modwithfriends.Notification) error {
+	bn.started <- chatID
+	<-bn.released
+	return nil
+}
+
+func TestRetrySkipsDeactivatedUsersAndConcurrentRetries(t *testing.T) {
+	db := inmem.NewDB()
+	users := &inmem.UserService{DB: db}
+	for _, chatID := range []modwithfriends.ChatID{1, 2, 3} {
+		if err := users.CreateUser(chatID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := users.DeactivateUser(3); err != nil {
+		t.Fatal(err)
+	}
+
+	subject := "Subject"
+	broadcasts := &fakeBroadcasts{broadcast: modwithfriends.Broadcast{
+		ID:      "00000000-0000-0000-0000-000000000001",
+		Subject: &subject,
+		Message: "Message",
+		Failures: []modwithfriends.BroadcastFailure{
+			{User: 1, ReasonString: "timed out"},
+			{User: 3, ReasonString: "timed out"},
+		},
+	}}
+	notifier := &blockingNotifier{started: make(chan modwithfriends.ChatID), released: make(chan struct{})}
+	b := &broadcaster{Notifier: notifier, UserService: users, BroadcastService: broadcasts}
+
+	type result struct {
+		res broadcastResponse
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		_, res, err := b.retry(broadcasts.broadcast.ID)
+		done <- result{res, err}
+	}()
+
+	if got := <-notifier.started; got != 1 {
+		t.Errorf("retry notified %d, want 1", got)
+	}
+	if _, _, err := b.retry(broadcasts.broadcast.ID); err != errRetryInProgress {
+		t.Errorf("concurrent retry = %v, want %v", err, errRetryInProgress)
+	}
+	close(notifier.released)
+
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if want := []modwithfriends.ChatID{1}; !reflect.DeepEqual(r.res.Recovered, want) {
+		t.Errorf("Recovered = %v, want %v", r.res.Recovered, want)
+	}
+	if want := []modwithfriends.ChatID{3}; !reflect.DeepEqual(r.res.Skipped, want) {
+		t.Errorf("Skipped = %v, want %v", r.res.Skipped, want)
+	}
+	// The skipped user's failure is kept for a later retry.
+	if failures := broadcasts.broadcast.Failures; len(failures) != 1 || failures[0].User != 3 {
+		t.Errorf("failures left = %v, want user 3's", failures)
+	}
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	forwardedForHeader = "X-Forwarded-For"
+	clientIPContext    = "clientIP"
+)
+
+// clientIPs works out the address a request came from. Anyone can send an
+// X-Forwarded-For header, so only the hops added by trusted proxies are
+// believed: the client is the rightmost hop that is not a trusted proxy.
+type clientIPs struct {
+	trusted []*net.IPNet
+}
+
+func newClientIPs(trustedProxies []string) (*clientIPs, error) {
+	trusted, err := parseIPNets(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse trusted proxies: %w", err)
+	}
+	return &clientIPs{trusted: trusted}, nil
+}
+
+// resolve sets the client IP of the request for clientIP to return.
+func (ci *clientIPs) resolve(c *gin.Context) {
+	c.Set(clientIPContext, ci.clientIP(c.Request))
+	c.Next()
+}
+
+func (ci *clientIPs) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !ci.isTrusted(ip) {
+		return ip
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values(forwardedForHeader) {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// A proxy would not have added it, so it is as far back as can
+			// be believed.
+			break
+		}
+		ip = hop
+		if !ci.isTrusted(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (ci *clientIPs) isTrusted(ip string) bool {
+	return containsIP(ci.trusted, ip)
+}
+
+// clientIP returns the address the request came from, as resolved by
+// clientIPs.
+func clientIP(c *gin.Context) string {
+	if ip := c.GetString(clientIPContext); ip != "" {
+		return ip
+	}
+	return remoteIP(c.Request)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		return strings.TrimSpace(r.RemoteAddr)
+	}
+	return host
+}
+
+// parseIPNets parses a list of IP addresses and CIDR ranges, skipping blank
+// entries.
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	ipNets := []*net.IPNet{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse IP %q: %w", entry, err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+func containsIP(ipNets []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
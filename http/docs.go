@@ -0,0 +1,19 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type docsHandler struct {
+	Router *gin.Engine
+}
+
+func (dh *docsHandler) register() {
+	dh.Router.GET("/api/docs", dh.getDocs)
+}
+
+func (dh *docsHandler) getDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", openAPISpec)
+}
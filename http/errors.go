@@ -0,0 +1,112 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"modwithfriends"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader  = "X-Request-ID"
+	requestIDContext = "requestID"
+)
+
+// Error codes are part of the API, clients may depend on them so they must
+// not be changed.
+const (
+	codeInvalidRequest = "INVALID_REQUEST"
+	codeUnauthorized   = "UNAUTHORIZED"
+	codeForbidden      = "FORBIDDEN"
+	codeNotFound       = "NOT_FOUND"
+	codeAlreadyExists  = "ALREADY_EXISTS"
+	codeConflict       = "CONFLICT"
+	codeRateLimited    = "RATE_LIMITED"
+	codeInternal       = "INTERNAL"
+)
+
+// apiError is an error that is safe to show to clients as is.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func invalidRequest(msg string) *apiError {
+	return &apiError{http.StatusBadRequest, codeInvalidRequest, msg}
+}
+
+func conflict(msg string) *apiError {
+	return &apiError{http.StatusConflict, codeConflict, msg}
+}
+
+type errorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+// toAPIError maps errors from the services to the error shown to clients.
+// Errors that are not known are logged and hidden behind a generic message.
+func toAPIError(c *gin.Context, err error) *apiError {
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, modwithfriends.ErrEntityNotFound):
+		return &apiError{http.StatusNotFound, codeNotFound, "Entity does not exist"}
+	case errors.Is(err, modwithfriends.ErrDuplicateEntityFound):
+		return &apiError{http.StatusConflict, codeAlreadyExists, "Entity already exists"}
+	case errors.Is(err, modwithfriends.ErrEntityInUse):
+		return &apiError{http.StatusConflict, codeConflict, "Entity is still in use"}
+	default:
+		log.Printf("[%s] %s %s: %s", requestID(c), c.Request.Method, c.Request.URL.Path, err)
+		return &apiError{http.StatusInternalServerError, codeInternal, "An unexpected error has occurred"}
+	}
+}
+
+func abortWithError(c *gin.Context, err error) {
+	apiErr := toAPIError(c, err)
+	c.AbortWithStatusJSON(apiErr.Status, errorResponse{errorBody{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		RequestID: requestID(c),
+	}})
+}
+
+// withRequestID tags each request with the X-Request-ID it came with, or a
+// new one, and echoes it back in the response.
+func withRequestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = uuid.New().String()
+	}
+
+	c.Set(requestIDContext, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDContext)
+}
+
+func handleNoRoute(c *gin.Context) {
+	abortWithError(c, &apiError{http.StatusNotFound, codeNotFound, "Route does not exist"})
+}
+
+func handlePanic(c *gin.Context, recovered interface{}) {
+	abortWithError(c, fmt.Errorf("Recovered from panic: %v", recovered))
+}
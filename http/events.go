@@ -0,0 +1,94 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"modwithfriends"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const heartbeatInterval = 30 * time.Second
+
+// groupProgress is a group event without anything that identifies the group
+// or its members, so that it can be streamed to anyone.
+type groupProgress struct {
+	Type       modwithfriends.GroupEventType `json:"type"`
+	ModuleCode modwithfriends.ModuleCode     `json:"moduleCode"`
+	Members    int                           `json:"members"`
+	Size       int                           `json:"size"`
+	Invited    bool                          `json:"invited"`
+	Message    string                        `json:"message"`
+}
+
+type eventsHandler struct {
+	Router     *gin.Engine
+	Subscriber modwithfriends.GroupEventSubscriber
+	// Closing ends the streams when the server shuts down.
+	Closing <-chan struct{}
+}
+
+func (eh *eventsHandler) register() {
+	eh.Router.GET("/api/v1/events/groups", eh.streamGroupProgress)
+}
+
+// streamGroupProgress pushes group progress to the client as Server-Sent
+// Events until it disconnects or the server shuts down. Comments are sent now
+// and then to keep proxies from closing the connection.
+func (eh *eventsHandler) streamGroupProgress(c *gin.Context) {
+	events, unsubscribe := eh.Subscriber.Subscribe()
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// The headers are sent straight away rather than with the first event, so
+	// that the client knows it is an event stream before anything happens.
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-eh.Closing:
+			return false
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("progress", newGroupProgress(e))
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		}
+	})
+}
+
+func newGroupProgress(e modwithfriends.GroupEvent) groupProgress {
+	progress := groupProgress{
+		Type:       e.Type,
+		ModuleCode: e.Group.ModuleCode,
+		Members:    len(e.Group.Members),
+		Size:       modwithfriends.GroupSize,
+		Invited:    e.Group.InviteLink != nil,
+	}
+
+	switch {
+	case e.Type == modwithfriends.GroupDeleted:
+		progress.Members = 0
+		progress.Message = fmt.Sprintf("%s group dissolved", progress.ModuleCode)
+	case progress.Invited:
+		progress.Message = fmt.Sprintf("%s group is ready", progress.ModuleCode)
+	default:
+		progress.Message = fmt.Sprintf("%s group now %d/%d", progress.ModuleCode, progress.Members, progress.Size)
+	}
+
+	return progress
+}
@@ -1,78 +1,73 @@
 package http
 
 import (
-	"fmt"
-	"log"
 	"modwithfriends"
-	"modwithfriends/bot"
 	"net/http"
-	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-const hackyAuthHeader = "X-LMAO-OOPS"
-
 type groupResponse struct {
 	ModuleCode modwithfriends.ModuleCode `json:"module"`
 	Members    int                       `json:"members"`
 }
 
 type groupsHandler struct {
-	Router       *gin.Engine
-	Bot          modwithfriends.Bot
-	GroupService modwithfriends.GroupService
-	UserService  modwithfriends.UserService
-	Pwd          string
+	Router        *gin.Engine
+	Broadcaster   *broadcaster
+	GroupService  modwithfriends.GroupService
+	UserService   modwithfriends.UserService
+	ModuleService modwithfriends.ModuleService
+	Auth          *authenticator
+	Idempotency   *idempotency
+	Audit         *auditor
 }
 
 func (gh *groupsHandler) register() {
 	v0 := gh.Router.Group("/api/v0/groups")
-	v0Protected := gh.Router.Group("/api/v0/groups", gh.hackyAuth)
 
 	v0.GET("/", gh.getGroupsBy)
 
-	v0Protected.GET("/:groupID", gh.getGroupByID)
-	v0Protected.GET("/incomplete", gh.getIncompleteGroups)
-	v0Protected.PATCH("/:groupID", gh.updateGroup)
+	v0.GET("/:groupID", gh.Auth.require(modwithfriends.ScopeGroupsRead), gh.getGroupByID)
+	v0.GET("/incomplete", gh.Auth.require(modwithfriends.ScopeGroupsRead), gh.getIncompleteGroups)
+	v0.PATCH("/:groupID", gh.Auth.require(modwithfriends.ScopeGroupsWrite), gh.Idempotency.handle, gh.updateGroup)
+	v0.POST("/invite-links", gh.Auth.require(modwithfriends.ScopeGroupsWrite), gh.assignInviteLinks)
+
+	v1Read := gh.Router.Group("/api/v1/groups", gh.Auth.require(modwithfriends.ScopeGroupsRead))
+	v1Write := gh.Router.Group("/api/v1/groups", gh.Auth.require(modwithfriends.ScopeGroupsWrite))
+
+	v1Read.GET("/", gh.getGroups)
+	v1Read.GET("/:groupID", gh.getGroupByID)
+
+	v1Write.POST("/", gh.createGroup)
+	v1Write.PATCH("/:groupID", gh.updateInviteLink)
+	v1Write.DELETE("/:groupID", gh.dissolveGroup)
+	v1Write.POST("/:groupID/members", gh.addMember)
+	v1Write.DELETE("/:groupID/members/:userID", gh.removeMember)
+	v1Write.POST("/:groupID/members/:userID/move", gh.moveMember)
 }
 
-func (gh *groupsHandler) hackyAuth(c *gin.Context) {
-	token := c.GetHeader(hackyAuthHeader)
-	if token != gh.Pwd {
-		c.AbortWithStatus(http.StatusNotFound)
+// getIncompleteGroups lists full groups that are waiting on an invite link.
+func (gh *groupsHandler) getIncompleteGroups(c *gin.Context) {
+	query, err := parseGroupQuery(c, modwithfriends.GroupStateFull)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	c.Next()
-}
 
-func (gh *groupsHandler) getIncompleteGroups(c *gin.Context) {
-	groups, err := gh.GroupService.GroupsBy(modwithfriends.GroupQuery{
-		Invited: false,
-		MemberCriteriaQuery: &modwithfriends.MemberCriteriaQuery{
-			Condition: modwithfriends.MoreThanOrEqual,
-			Count:     5,
-		},
-	})
+	groups, err := gh.GroupService.GroupsBy(query)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		abortWithError(c, err)
 		return
 	}
 
+	setNextCursor(c, query, groups)
 	c.JSON(http.StatusOK, groups)
 }
 
 func (gh *groupsHandler) getGroupByID(c *gin.Context) {
-	groupID := c.Param("groupID")
-
-	group, err := gh.GroupService.Group(groupID)
-	if err == modwithfriends.ErrEntityNotFound {
-		c.AbortWithStatusJSON(http.StatusNotFound, newStandardResponse("Nope, doesn't exist"))
-		return
-	}
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+	group, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
 		return
 	}
 
@@ -80,105 +75,56 @@ func (gh *groupsHandler) getGroupByID(c *gin.Context) {
 }
 
 func (gh *groupsHandler) updateGroup(c *gin.Context) {
-	groupID := c.Param("groupID")
-
-	groupToUpdate, err := gh.GroupService.Group(groupID)
-	if err == modwithfriends.ErrEntityNotFound {
-		c.AbortWithStatusJSON(http.StatusNotFound, newStandardResponse("Nope, doesn't exist"))
-		return
-	}
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+	groupToUpdate, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
 		return
 	}
+	groupID := groupToUpdate.ID
+
+	// Binding decodes into the existing group, so keep a copy of it.
+	previous := copyGroup(groupToUpdate)
 
 	if err := c.ShouldBindJSON(&groupToUpdate); err != nil || groupToUpdate.ID != groupID {
-		c.AbortWithStatusJSON(http.StatusBadRequest, err)
+		abortWithError(c, invalidRequest("Please provide the group as JSON with a groupId matching the URL"))
 		return
 	}
 
-	err = gh.GroupService.UpdateGroup(groupID, groupToUpdate)
+	err := gh.GroupService.UpdateGroup(groupID, groupToUpdate)
 	if err != nil {
-		log.Println(err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		abortWithError(c, err)
 		return
 	}
+	gh.Audit.record(c, modwithfriends.AuditGroupUpdate, groupID, previous, groupToUpdate)
 
-	broadcastFailures := []modwithfriends.BroadcastFailure{}
-
-	if groupToUpdate.InviteLink != nil {
-		broadcastFailures = gh.Bot.Broadcast(
-			groupToUpdate.Members,
-			fmt.Sprintf("Your mod group for %s is ready at: %s", groupToUpdate.ModuleCode, *groupToUpdate.InviteLink),
-			nil,
-		)
+	res := broadcastResponse{
+		FailedToReach: []modwithfriends.BroadcastFailure{},
+		Errors:        []string{},
 	}
-
-	deletionErrors := []string{}
-
-	for _, failure := range broadcastFailures {
-		if failure.Reason == bot.ErrUserDeactivated {
-			err := gh.UserService.DeleteUser(failure.User)
-			if err != nil {
-				deletionErrors = append(deletionErrors, fmt.Sprintf("Failed to delete user %d: %s", failure.User, err.Error()))
-			}
-		}
+	// Members are only told of a new invite link, so that sending the same
+	// update again does not notify them twice.
+	if groupToUpdate.InviteLink != nil && !sameInviteLink(previous.InviteLink, groupToUpdate.InviteLink) {
+		res = gh.Broadcaster.notifyInviteLink(groupToUpdate)
 	}
 
-	c.JSON(http.StatusOK, broadcastResponse{
-		Message:       "Yee update is successful",
-		FailedToReach: broadcastFailures,
-		Errors:        deletionErrors,
-	})
+	res.Message = "Yee update is successful"
+	c.JSON(http.StatusOK, res)
 }
 
 func (gh *groupsHandler) getGroupsBy(c *gin.Context) {
-	var memberCount *int
-	var moduleCode *modwithfriends.ModuleCode
-
-	memberCountQuery, sizeExist := c.GetQuery("size")
-	if sizeExist {
-		val, err := strconv.Atoi(memberCountQuery)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest,
-				newStandardResponse("Please provide a valid integer for the size query"))
-			return
-		}
-		memberCount = &val
-	}
-
-	moduleCodeQuery, moduleCodeExist := c.GetQuery("module")
-	moduleCodeQueryClean := strings.ReplaceAll(strings.ToUpper(moduleCodeQuery), " ", "")
-	if moduleCodeExist && moduleCodeQueryClean == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest,
-			newStandardResponse("Please provide a valid module code for the module query"))
+	query, err := parseGroupQuery(c, modwithfriends.GroupStateForming, modwithfriends.GroupStateFull)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	if moduleCodeExist && moduleCodeQueryClean != "" {
-		val := modwithfriends.ModuleCode(moduleCodeQueryClean)
-		moduleCode = &val
-	}
-
-	var memberCriteriaQuery *modwithfriends.MemberCriteriaQuery
-	if memberCount != nil {
-		memberCriteriaQuery = &modwithfriends.MemberCriteriaQuery{
-			Condition: modwithfriends.Equal,
-			Count:     *memberCount,
-		}
-	}
 
-	groups, err := gh.GroupService.GroupsBy(modwithfriends.GroupQuery{
-		Invited:             false,
-		ModuleCode:          moduleCode,
-		MemberCriteriaQuery: memberCriteriaQuery,
-	})
+	groups, err := gh.GroupService.GroupsBy(query)
 	if err != nil {
-		log.Println("Critical error occurred with GroupsBy endpoint: " + err.Error())
-		c.AbortWithStatusJSON(http.StatusInternalServerError,
-			newStandardResponse("Hmmmm, something is not right 🖕"))
+		abortWithError(c, err)
 		return
 	}
 
+	setNextCursor(c, query, groups)
+
 	declassifiedGroups := []groupResponse{}
 	for _, group := range groups {
 		declassifiedGroups = append(declassifiedGroups, groupResponse{
@@ -189,3 +135,20 @@ func (gh *groupsHandler) getGroupsBy(c *gin.Context) {
 
 	c.JSON(http.StatusOK, declassifiedGroups)
 }
+
+// copyGroup copies the group without sharing its invite link or members.
+func copyGroup(g modwithfriends.Group) modwithfriends.Group {
+	if g.InviteLink != nil {
+		link := *g.InviteLink
+		g.InviteLink = &link
+	}
+	g.Members = append([]modwithfriends.ChatID{}, g.Members...)
+	return g
+}
+
+func sameInviteLink(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"modwithfriends"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// pollStaleAfter is well past the long polling timeout of the bot, so a
+	// poll this old means the poller is stuck.
+	pollStaleAfter = time.Minute
+	// startupGrace is how long the bot has to make its first poll.
+	startupGrace  = time.Minute
+	pingTimeout   = 2 * time.Second
+	statusOK      = "ok"
+	statusFailing = "unavailable"
+)
+
+type healthCheck struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// healthHandler serves the liveness and readiness checks along with the
+// Prometheus metrics. Liveness only checks the Telegram poller, as restarting
+// the server does not bring the database back. The metrics tell of traffic
+// and the database's internals, so they take an API key.
+type healthHandler struct {
+	Router   *gin.Engine
+	Database modwithfriends.Database
+	Bot      modwithfriends.Bot
+	Auth     *authenticator
+
+	startedAt time.Time
+}
+
+func (hh *healthHandler) register() {
+	hh.startedAt = time.Now()
+
+	hh.Router.GET("/healthz", hh.healthz)
+	hh.Router.GET("/readyz", hh.readyz)
+	hh.Router.GET("/metrics", hh.Auth.require(modwithfriends.ScopeMetricsRead), gin.WrapH(promhttp.Handler()))
+}
+
+func (hh *healthHandler) healthz(c *gin.Context) {
+	respondWithChecks(c, map[string]healthCheck{
+		"telegram": hh.checkTelegram(time.Now()),
+	})
+}
+
+func (hh *healthHandler) readyz(c *gin.Context) {
+	respondWithChecks(c, map[string]healthCheck{
+		"database": hh.checkDatabase(c.Request.Context()),
+		"telegram": hh.checkTelegram(time.Now()),
+	})
+}
+
+func (hh *healthHandler) checkDatabase(ctx context.Context) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := hh.Database.PingContext(ctx); err != nil {
+		return healthCheck{Message: "Failed to reach database: " + err.Error()}
+	}
+
+	return healthCheck{OK: true, Message: fmt.Sprintf("Reached database in %dms", time.Since(start).Milliseconds())}
+}
+
+func (hh *healthHandler) checkTelegram(now time.Time) healthCheck {
+	lastPoll := hh.Bot.LastPoll()
+	if lastPoll.IsZero() {
+		if now.Sub(hh.startedAt) < startupGrace {
+			return healthCheck{OK: true, Message: "Waiting for the first poll"}
+		}
+		return healthCheck{Message: "Telegram has not been polled since the server started"}
+	}
+
+	sincePoll := now.Sub(lastPoll).Round(time.Second)
+	if sincePoll > pollStaleAfter {
+		return healthCheck{Message: fmt.Sprintf("Telegram was last polled %s ago", sincePoll)}
+	}
+	return healthCheck{OK: true, Message: fmt.Sprintf("Telegram was last polled %s ago", sincePoll)}
+}
+
+func respondWithChecks(c *gin.Context, checks map[string]healthCheck) {
+	res := healthResponse{Status: statusOK, Checks: checks}
+	status := http.StatusOK
+
+	for _, check := range checks {
+		if !check.OK {
+			res.Status = statusFailing
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, res)
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"modwithfriends"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotentReplayed   = "Idempotent-Replayed"
+)
+
+// idempotency lets clients retry requests safely: a request sent again with
+// the same Idempotency-Key is answered with the saved response of the first
+// one instead of being carried out again. Keys are scoped to the API key the
+// request is authenticated with, so it must come after authentication.
+type idempotency struct {
+	IdempotencyService modwithfriends.IdempotencyService
+}
+
+func (i *idempotency) handle(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	requestHash := hashRequest(c.Request, body)
+	apiKeyID := c.MustGet(apiKeyContext).(modwithfriends.APIKey).ID
+
+	record, reserved, err := i.IdempotencyService.Reserve(apiKeyID, key, requestHash)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if !reserved {
+		switch {
+		case record.RequestHash != requestHash:
+			abortWithError(c, &apiError{http.StatusUnprocessableEntity, codeInvalidRequest, "Idempotency-Key has already been used for a different request"})
+		case record.StatusCode == nil:
+			abortWithError(c, conflict("A request with this Idempotency-Key is still in progress"))
+		default:
+			c.Header(idempotentReplayed, "true")
+			c.Data(*record.StatusCode, "application/json; charset=utf-8", record.Body)
+			c.Abort()
+		}
+		return
+	}
+
+	w := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+
+	// Server errors are not saved, so that the request can be retried once
+	// whatever went wrong is fixed.
+	if w.Status() >= http.StatusInternalServerError {
+		err = i.IdempotencyService.Release(apiKeyID, key)
+	} else {
+		err = i.IdempotencyService.Complete(apiKeyID, key, w.Status(), w.body.Bytes())
+	}
+	if err != nil {
+		log.Printf("[%s] %s", requestID(c), err)
+	}
+}
+
+// recordingWriter keeps a copy of the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func hashRequest(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"modwithfriends"
+	"modwithfriends/sqlite"
+	"modwithfriends/sqlstore"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyKeysAreScopedToAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := sqlite.Open("sqlite::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := sqlite.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	i := &idempotency{IdempotencyService: &sqlstore.IdempotencyService{DB: db}}
+
+	calls := 0
+	router := gin.New()
+	router.POST("/", func(c *gin.Context) {
+		c.Set(apiKeyContext, modwithfriends.APIKey{ID: c.GetHeader("X-Key-Id")})
+	}, i.handle, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	send := func(keyID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		req.Header.Set("X-Key-Id", keyID)
+		req.Header.Set(idempotencyKeyHeader, "same-key")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		keyID    string
+		replayed bool
+		body     string
+	}{
+		{"first request", "00000000-0000-0000-0000-000000000001", false, `{"calls":1}`},
+		{"retry by the same API key", "00000000-0000-0000-0000-000000000001", true, `{"calls":1}`},
+		{"same key from another API key", "00000000-0000-0000-0000-000000000002", false, `{"calls":2}`},
+		{"same key from the shared password", "", false, `{"calls":3}`},
+	}
+
+	for _, test := range tests {
+		res := send(test.keyID)
+		if res.Code != http.StatusOK {
+			t.Errorf("%s got %d, want %d", test.name, res.Code, http.StatusOK)
+		}
+		if replayed := res.Header().Get(idempotentReplayed) == "true"; replayed != test.replayed {
+			t.Errorf("%s replayed = %t, want %t", test.name, replayed, test.replayed)
+		}
+		if res.Body.String() != test.body {
+			t.Errorf("%s got body %s, want %s", test.name, res.Body.String(), test.body)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package http
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"modwithfriends"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxInviteLinkRows  = 500
+	maxInviteLinksBody = 1 << 20
+)
+
+type inviteLinkRow struct {
+	Row        int                `json:"row"`
+	GroupID    string             `json:"groupId,omitempty"`
+	InviteLink string             `json:"inviteLink"`
+	Error      string             `json:"error,omitempty"`
+	Broadcast  *broadcastResponse `json:"broadcast,omitempty"`
+}
+
+type inviteLinksReport struct {
+	Applied bool            `json:"applied"`
+	Rows    []inviteLinkRow `json:"rows"`
+}
+
+// assignInviteLinks issues invite links in bulk from a CSV of groupId,inviteLink
+// rows. Rows with just a link go to the full groups that have waited longest.
+// Either every row is applied or, if any row is invalid, none of them are.
+func (gh *groupsHandler) assignInviteLinks(c *gin.Context) {
+	rows, err := readInviteLinkRows(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	valid, err := gh.validateInviteLinkRows(rows)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnprocessableEntity, inviteLinksReport{Rows: rows})
+		return
+	}
+
+	assignments := []modwithfriends.InviteLinkAssignment{}
+	for _, row := range rows {
+		assignments = append(assignments, modwithfriends.InviteLinkAssignment{
+			GroupID:    row.GroupID,
+			InviteLink: row.InviteLink,
+		})
+	}
+
+	err = gh.GroupService.AssignInviteLinks(assignments)
+	switch {
+	case errors.Is(err, modwithfriends.ErrDuplicateEntityFound):
+		abortWithError(c, conflict("An invite link is already used by another group"))
+		return
+	case errors.Is(err, modwithfriends.ErrEntityNotFound):
+		abortWithError(c, conflict("A group was changed while the invite links were being assigned, please try again"))
+		return
+	case err != nil:
+		abortWithError(c, err)
+		return
+	}
+
+	for i, row := range rows {
+		group, err := gh.GroupService.Group(row.GroupID)
+		if err != nil {
+			rows[i].Error = "Invite link was assigned but its members could not be notified: " + toAPIError(c, err).Message
+			continue
+		}
+
+		// Invite links are only assigned to groups that had none.
+		previous := copyGroup(group)
+		previous.InviteLink = nil
+		gh.Audit.record(c, modwithfriends.AuditGroupInviteLink, group.ID, previous, group)
+
+		res := gh.Broadcaster.notifyInviteLink(group)
+		res.Message = "Invite link sent"
+		rows[i].Broadcast = &res
+	}
+
+	c.JSON(http.StatusOK, inviteLinksReport{Applied: true, Rows: rows})
+}
+
+func readInviteLinkRows(c *gin.Context) ([]inviteLinkRow, error) {
+	reader := csv.NewReader(http.MaxBytesReader(c.Writer, c.Request.Body, maxInviteLinksBody))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, invalidRequest("Please provide the invite links as CSV, " + err.Error())
+	}
+
+	rows := []inviteLinkRow{}
+	for i, record := range records {
+		if i == 0 && isInviteLinksHeader(record) {
+			continue
+		}
+
+		row := inviteLinkRow{Row: i + 1}
+		switch len(record) {
+		case 1:
+			row.InviteLink = record[0]
+		case 2:
+			row.GroupID, row.InviteLink = strings.TrimSpace(record[0]), record[1]
+		default:
+			row.Error = "Expected a groupId,inviteLink row or just an invite link"
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, invalidRequest("Please provide at least one invite link")
+	}
+	if len(rows) > maxInviteLinkRows {
+		return nil, invalidRequest(fmt.Sprintf("Please provide at most %d invite links at a time", maxInviteLinkRows))
+	}
+
+	return rows, nil
+}
+
+func isInviteLinksHeader(record []string) bool {
+	for _, field := range record {
+		if strings.EqualFold(strings.TrimSpace(field), "inviteLink") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateInviteLinkRows checks every row, filling in the group of rows with
+// just a link, and reports whether all of them can be applied.
+func (gh *groupsHandler) validateInviteLinkRows(rows []inviteLinkRow) (bool, error) {
+	assignedGroups := map[string]bool{}
+	usedLinks := map[string]bool{}
+
+	// Links are unique across groups, so links already issued are looked up
+	// to report them by row rather than fail the whole upload.
+	invitedGroups, err := gh.GroupService.GroupsBy(modwithfriends.GroupQuery{
+		States: []modwithfriends.GroupState{modwithfriends.GroupStateInvited},
+	})
+	if err != nil {
+		return false, err
+	}
+	issuedLinks := map[string]bool{}
+	for _, group := range invitedGroups {
+		issuedLinks[*group.InviteLink] = true
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		if row.Error != "" {
+			continue
+		}
+
+		link, err := parseInviteLink(row.InviteLink)
+		if err != nil {
+			row.Error = errInvalidInviteLink.Message
+			continue
+		}
+		row.InviteLink = link
+
+		if usedLinks[link] {
+			row.Error = "Invite link appears more than once"
+			continue
+		}
+		usedLinks[link] = true
+
+		if issuedLinks[link] {
+			row.Error = "Invite link is already used by another group"
+			continue
+		}
+
+		if row.GroupID == "" {
+			continue
+		}
+
+		if _, err := parseGroupID(row.GroupID); err != nil {
+			row.Error = errInvalidGroupID.Message
+			continue
+		}
+
+		group, err := gh.GroupService.Group(row.GroupID)
+		if errors.Is(err, modwithfriends.ErrEntityNotFound) {
+			row.Error = "Group does not exist"
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case group.InviteLink != nil:
+			row.Error = "Group already has an invite link"
+		case assignedGroups[group.ID]:
+			row.Error = "Group appears more than once"
+		}
+		assignedGroups[group.ID] = true
+	}
+
+	if err := gh.autoAssignInviteLinks(rows, assignedGroups); err != nil {
+		return false, err
+	}
+
+	for _, row := range rows {
+		if row.Error != "" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// autoAssignInviteLinks gives rows with just a link to the full groups that
+// were formed first and are not given a link by another row.
+func (gh *groupsHandler) autoAssignInviteLinks(rows []inviteLinkRow, assignedGroups map[string]bool) error {
+	unassigned := []*inviteLinkRow{}
+	for i := range rows {
+		if rows[i].GroupID == "" && rows[i].Error == "" {
+			unassigned = append(unassigned, &rows[i])
+		}
+	}
+	if len(unassigned) == 0 {
+		return nil
+	}
+
+	groups, err := gh.GroupService.GroupsBy(modwithfriends.GroupQuery{
+		States: []modwithfriends.GroupState{modwithfriends.GroupStateFull},
+		SortBy: modwithfriends.SortByCreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if len(unassigned) == 0 {
+			break
+		}
+		if assignedGroups[group.ID] {
+			continue
+		}
+		unassigned[0].GroupID = group.ID
+		assignedGroups[group.ID] = true
+		unassigned = unassigned[1:]
+	}
+
+	for _, row := range unassigned {
+		row.Error = "There is no full group left to assign the invite link to"
+	}
+	return nil
+}
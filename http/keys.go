@@ -0,0 +1,171 @@
+package http
+
+import (
+	"modwithfriends"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiKeyRequest struct {
+	Name      string                 `json:"name"`
+	Scopes    []modwithfriends.Scope `json:"scopes"`
+	ExpiresAt *time.Time             `json:"expiresAt"`
+}
+
+type apiKeyResponse struct {
+	modwithfriends.APIKey
+	Key string `json:"key"`
+}
+
+type keysHandler struct {
+	Router        *gin.Engine
+	Auth          *authenticator
+	APIKeyService modwithfriends.APIKeyService
+	Audit         *auditor
+}
+
+func (kh *keysHandler) register() {
+	v0 := kh.Router.Group("/api/v0/keys", kh.Auth.require(modwithfriends.ScopeKeysAdmin))
+
+	v0.GET("/", kh.getAPIKeys)
+	v0.POST("/", kh.issueAPIKey)
+	v0.POST("/:keyID/rotate", kh.rotateAPIKey)
+	v0.DELETE("/:keyID", kh.revokeAPIKey)
+}
+
+func (kh *keysHandler) getAPIKeys(c *gin.Context) {
+	keys, err := kh.APIKeyService.APIKeys()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (kh *keysHandler) issueAPIKey(c *gin.Context) {
+	req := apiKeyRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || len(req.Scopes) == 0 {
+		abortWithError(c, invalidRequest("Please provide a name and at least one scope for the API key"))
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !isValidScope(scope) {
+			abortWithError(c, invalidRequest("Unknown scope: "+string(scope)))
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		abortWithError(c, invalidRequest("API key cannot expire in the past"))
+		return
+	}
+
+	secret, prefix, err := generateAPIKey()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	keyID, err := kh.APIKeyService.CreateAPIKey(modwithfriends.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		Hash:      hashAPIKey(secret),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	key, err := kh.APIKeyService.APIKey(keyID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	kh.Audit.record(c, modwithfriends.AuditAPIKeyIssue, key.ID, nil, key)
+
+	c.JSON(http.StatusCreated, apiKeyResponse{APIKey: key, Key: secret})
+}
+
+// rotateAPIKey replaces the key's secret, the old secret stops working at once.
+func (kh *keysHandler) rotateAPIKey(c *gin.Context) {
+	keyID, err := parseAPIKeyID(c.Param("keyID"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	key, err := kh.APIKeyService.APIKey(keyID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if key.RevokedAt != nil {
+		abortWithError(c, conflict("Revoked API keys cannot be rotated"))
+		return
+	}
+
+	secret, prefix, err := generateAPIKey()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	previous := key
+	key.Prefix = prefix
+	key.Hash = hashAPIKey(secret)
+
+	err = kh.APIKeyService.UpdateAPIKey(keyID, key)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	kh.Audit.record(c, modwithfriends.AuditAPIKeyRotate, keyID, previous, key)
+
+	c.JSON(http.StatusOK, apiKeyResponse{APIKey: key, Key: secret})
+}
+
+func (kh *keysHandler) revokeAPIKey(c *gin.Context) {
+	keyID, err := parseAPIKeyID(c.Param("keyID"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	key, err := kh.APIKeyService.APIKey(keyID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if key.RevokedAt == nil {
+		previous := key
+		now := time.Now()
+		key.RevokedAt = &now
+
+		err = kh.APIKeyService.UpdateAPIKey(keyID, key)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		kh.Audit.record(c, modwithfriends.AuditAPIKeyRevoke, keyID, previous, key)
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+func isValidScope(scope modwithfriends.Scope) bool {
+	for _, s := range modwithfriends.AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,8 @@
 package http
 
 import (
-	"fmt"
 	"modwithfriends"
-	"modwithfriends/bot"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,67 +11,80 @@ type broadcastRequest struct {
 	Message string `json:"message"`
 }
 
-type broadcastResponse struct {
-	Message       string                            `json:"message"`
-	FailedToReach []modwithfriends.BroadcastFailure `json:"failedToReach"`
-	Errors        []string                          `json:"errors"`
-}
-
 // TODO: Clearly the APIs are a whack job, probably needs to be re-written lmao.
 type magicHandler struct {
 	Router      *gin.Engine
-	Bot         modwithfriends.Bot
-	UserService modwithfriends.UserService
-	Pwd         string
+	Broadcaster *broadcaster
+	Auth        *authenticator
+	Audit       *auditor
 }
 
 func (mh *magicHandler) register() {
-	v0 := mh.Router.Group("/api/v0/magic", mh.hackyAuth)
+	v0 := mh.Router.Group("/api/v0/magic", mh.Auth.require(modwithfriends.ScopeBroadcast))
 
 	v0.POST("/broadcast", mh.handleBroadcast)
+	v0.GET("/broadcasts/:broadcastID", mh.getBroadcastByID)
+	v0.POST("/broadcasts/:broadcastID/retry", mh.retryBroadcast)
 }
 
-func (mh *magicHandler) hackyAuth(c *gin.Context) {
-	token := c.GetHeader(hackyAuthHeader)
-	if token != mh.Pwd {
-		c.AbortWithStatus(http.StatusNotFound)
+func (mh *magicHandler) handleBroadcast(c *gin.Context) {
+	req := broadcastRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+
+	tmpl, err := modwithfriends.NewMessageTemplate(req.Message)
+	if err != nil {
+		abortWithError(c, invalidRequest(err.Error()))
+		return
+	}
+
+	res, err := mh.Broadcaster.broadcastToAll(req.Message, tmpl)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	c.Next()
+	mh.Audit.record(c, modwithfriends.AuditBroadcastSend, res.BroadcastID, nil, broadcastSnapshot{res.BroadcastID, req.Message, res.FailedToReach})
+
+	res.Message = "Broadcast successful"
+	c.JSON(http.StatusOK, res)
 }
 
-func (mh *magicHandler) handleBroadcast(c *gin.Context) {
-	req := broadcastRequest{}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+func (mh *magicHandler) getBroadcastByID(c *gin.Context) {
+	broadcastID, err := parseBroadcastID(c.Param("broadcastID"))
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	users, err := mh.UserService.Users()
+	broadcast, err := mh.Broadcaster.BroadcastService.Broadcast(broadcastID)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+		abortWithError(c, err)
 		return
 	}
 
-	broadcastFailures := mh.Bot.Broadcast(users, req.Message, &modwithfriends.BroadcastRate{
-		Rate:  20,
-		Delay: 1 * time.Second,
-	})
+	c.JSON(http.StatusOK, broadcast)
+}
 
-	deletionErrors := []string{}
+// retryBroadcast re-sends a broadcast to the users it has yet to reach, unless
+// it is already being retried.
+func (mh *magicHandler) retryBroadcast(c *gin.Context) {
+	broadcastID, err := parseBroadcastID(c.Param("broadcastID"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
 
-	for _, failure := range broadcastFailures {
-		if failure.Reason == bot.ErrUserDeactivated {
-			err := mh.UserService.DeleteUser(failure.User)
-			if err != nil {
-				deletionErrors = append(deletionErrors, fmt.Sprintf("Failed to delete user %d: %s", failure.User, err.Error()))
-			}
-		}
+	broadcast, res, err := mh.Broadcaster.retry(broadcastID)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
+	mh.Audit.record(c, modwithfriends.AuditBroadcastRetry, broadcast.ID,
+		broadcastSnapshot{broadcast.ID, broadcast.Message, broadcast.Failures},
+		broadcastSnapshot{broadcast.ID, broadcast.Message, res.FailedToReach})
 
-	c.JSON(http.StatusOK, broadcastResponse{
-		Message:       "Broadcast successful",
-		FailedToReach: broadcastFailures,
-		Errors:        deletionErrors,
-	})
+	res.Message = "Retry successful"
+	c.JSON(http.StatusOK, res)
 }
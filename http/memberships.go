@@ -0,0 +1,408 @@
+package http
+
+import (
+	"fmt"
+	"modwithfriends"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type createGroupRequest struct {
+	ModuleCode string                  `json:"moduleCode"`
+	InviteLink *string                 `json:"inviteLink"`
+	Members    []modwithfriends.ChatID `json:"members"`
+}
+
+type inviteLinkRequest struct {
+	InviteLink *string `json:"inviteLink"`
+	// Notify tells the members of a new invite link, unless it is false.
+	Notify *bool `json:"notify"`
+}
+
+type memberRequest struct {
+	ChatID modwithfriends.ChatID `json:"chatId"`
+}
+
+type moveMemberRequest struct {
+	GroupID string `json:"groupId"`
+}
+
+// groupTransfer is the audit snapshot of members going from one group to
+// another, From is nil once the group is dissolved.
+type groupTransfer struct {
+	From *modwithfriends.Group `json:"from"`
+	To   modwithfriends.Group  `json:"to"`
+}
+
+func (gh *groupsHandler) getGroups(c *gin.Context) {
+	query, err := parseGroupQuery(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	groups, err := gh.GroupService.GroupsBy(query)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	setNextCursor(c, query, groups)
+	c.JSON(http.StatusOK, groups)
+}
+
+func (gh *groupsHandler) createGroup(c *gin.Context) {
+	req := createGroupRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+
+	moduleCode, err := parseModuleCode(req.ModuleCode)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	modExist, err := gh.ModuleService.Exist(moduleCode)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if !modExist {
+		abortWithError(c, invalidRequest("Module does not exist, create it first"))
+		return
+	}
+
+	if len(req.Members) == 0 || len(req.Members) > modwithfriends.GroupSize {
+		abortWithError(c, invalidRequest(fmt.Sprintf("A group must have between 1 and %d members", modwithfriends.GroupSize)))
+		return
+	}
+
+	if req.InviteLink != nil {
+		inviteLink, err := parseInviteLink(*req.InviteLink)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		req.InviteLink = &inviteLink
+	}
+
+	seen := map[modwithfriends.ChatID]bool{}
+	for _, member := range req.Members {
+		if seen[member] {
+			abortWithError(c, invalidRequest(fmt.Sprintf("User %d is listed more than once", member)))
+			return
+		}
+		seen[member] = true
+
+		if !gh.canJoin(c, member, moduleCode) {
+			return
+		}
+	}
+
+	groupID, err := gh.GroupService.CreateGroup(modwithfriends.Group{
+		ModuleCode: moduleCode,
+		InviteLink: req.InviteLink,
+		Members:    req.Members,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	group, err := gh.GroupService.Group(groupID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	gh.Audit.record(c, modwithfriends.AuditGroupCreate, group.ID, nil, group)
+	c.JSON(http.StatusCreated, group)
+}
+
+// updateInviteLink sets a group's invite link and, like the v0 PATCH endpoint,
+// tells its members of a new one unless asked not to. The broadcast that told
+// them is named in the X-Broadcast-Id header.
+func (gh *groupsHandler) updateInviteLink(c *gin.Context) {
+	group, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	req := inviteLinkRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+
+	previous := copyGroup(group)
+	group.InviteLink = nil
+	if req.InviteLink != nil && *req.InviteLink != "" {
+		inviteLink, err := parseInviteLink(*req.InviteLink)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		group.InviteLink = &inviteLink
+	}
+
+	err := gh.GroupService.UpdateGroup(group.ID, group)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	gh.Audit.record(c, modwithfriends.AuditGroupInviteLink, group.ID, previous, group)
+
+	updatedGroup, err := gh.GroupService.Group(group.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	notify := req.Notify == nil || *req.Notify
+	if notify && updatedGroup.InviteLink != nil && !sameInviteLink(previous.InviteLink, updatedGroup.InviteLink) {
+		res := gh.Broadcaster.notifyInviteLink(updatedGroup)
+		if res.BroadcastID != "" {
+			c.Header(broadcastIDHeader, res.BroadcastID)
+		}
+	}
+
+	c.JSON(http.StatusOK, updatedGroup)
+}
+
+func (gh *groupsHandler) dissolveGroup(c *gin.Context) {
+	group, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	err := gh.GroupService.DeleteGroup(group.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	gh.Audit.record(c, modwithfriends.AuditGroupDelete, group.ID, group, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (gh *groupsHandler) addMember(c *gin.Context) {
+	group, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	req := memberRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChatID == 0 {
+		abortWithError(c, errInvalidChatID)
+		return
+	}
+
+	if !gh.hasSeat(c, group) || !gh.canJoin(c, req.ChatID, group.ModuleCode) {
+		return
+	}
+
+	previous := copyGroup(group)
+	group.Members = append(group.Members, req.ChatID)
+
+	gh.saveGroup(c, http.StatusCreated, modwithfriends.AuditGroupAddMember, previous, group)
+}
+
+// removeMember takes a user out of a group, dissolving the group if they were
+// its last member.
+func (gh *groupsHandler) removeMember(c *gin.Context) {
+	group, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	chatID, ok := gh.existingMember(c, group)
+	if !ok {
+		return
+	}
+
+	if len(group.Members) < 2 {
+		err := gh.GroupService.DeleteGroup(group.ID)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		gh.Audit.record(c, modwithfriends.AuditGroupRemoveMember, group.ID, group, nil)
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	previous := copyGroup(group)
+	group.Members = withoutMember(group.Members, chatID)
+
+	gh.saveGroup(c, http.StatusOK, modwithfriends.AuditGroupRemoveMember, previous, group)
+}
+
+// moveMember moves a user into another group of the same module, dissolving
+// the group they left if it is left empty.
+func (gh *groupsHandler) moveMember(c *gin.Context) {
+	from, ok := gh.existingGroup(c, c.Param("groupID"))
+	if !ok {
+		return
+	}
+
+	chatID, ok := gh.existingMember(c, from)
+	if !ok {
+		return
+	}
+
+	req := moveMemberRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+
+	to, ok := gh.existingGroup(c, req.GroupID)
+	if !ok {
+		return
+	}
+
+	if to.ID == from.ID {
+		abortWithError(c, invalidRequest("User is already in the group"))
+		return
+	}
+	if to.ModuleCode != from.ModuleCode {
+		abortWithError(c, invalidRequest("Members can only be moved between groups of the same module"))
+		return
+	}
+	if !gh.hasSeat(c, to) {
+		return
+	}
+
+	err := gh.GroupService.MoveMember(from.ID, to.ID, chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	moved, err := gh.GroupService.Group(to.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	after := groupTransfer{To: moved}
+	if len(from.Members) > 1 {
+		left := from
+		left.Members = withoutMember(from.Members, chatID)
+		after.From = &left
+	}
+	gh.Audit.record(c, modwithfriends.AuditGroupMoveMember, from.ID, groupTransfer{From: &from, To: to}, after)
+
+	c.JSON(http.StatusOK, moved)
+}
+
+// saveGroup updates the group, recording the action that changed it from
+// previous.
+func (gh *groupsHandler) saveGroup(c *gin.Context, status int, action modwithfriends.AuditAction, previous modwithfriends.Group, group modwithfriends.Group) {
+	err := gh.GroupService.UpdateGroup(group.ID, group)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	gh.Audit.record(c, action, group.ID, previous, group)
+
+	updatedGroup, err := gh.GroupService.Group(group.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(status, updatedGroup)
+}
+
+// existingGroup aborts unless groupID is a valid ID of an existing group.
+func (gh *groupsHandler) existingGroup(c *gin.Context, groupID string) (modwithfriends.Group, bool) {
+	groupID, err := parseGroupID(groupID)
+	if err != nil {
+		abortWithError(c, err)
+		return modwithfriends.Group{}, false
+	}
+
+	group, err := gh.GroupService.Group(groupID)
+	if err != nil {
+		abortWithError(c, err)
+		return modwithfriends.Group{}, false
+	}
+
+	return group, true
+}
+
+// existingMember aborts unless the userID param is a member of the group.
+func (gh *groupsHandler) existingMember(c *gin.Context, group modwithfriends.Group) (modwithfriends.ChatID, bool) {
+	chatID, err := parseChatID(c.Param("userID"))
+	if err != nil {
+		abortWithError(c, err)
+		return 0, false
+	}
+
+	for _, member := range group.Members {
+		if member == chatID {
+			return chatID, true
+		}
+	}
+
+	abortWithError(c, &apiError{http.StatusNotFound, codeNotFound, "User is not a member of the group"})
+	return 0, false
+}
+
+// hasSeat aborts unless the group can take another member. A group that has
+// been issued an invite link takes no one else, as they would never be sent
+// the link nor be able to leave.
+func (gh *groupsHandler) hasSeat(c *gin.Context, group modwithfriends.Group) bool {
+	if group.InviteLink != nil {
+		abortWithError(c, conflict("Group has already been issued an invite link"))
+		return false
+	}
+	if len(group.Members) >= modwithfriends.GroupSize {
+		abortWithError(c, conflict("Group is already full"))
+		return false
+	}
+	return true
+}
+
+// canJoin aborts unless the user exists and is not already in a group of the
+// module.
+func (gh *groupsHandler) canJoin(c *gin.Context, chatID modwithfriends.ChatID, code modwithfriends.ModuleCode) bool {
+	exist, err := gh.UserService.Exist(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return false
+	}
+	if !exist {
+		abortWithError(c, invalidRequest(fmt.Sprintf("User %d does not exist", chatID)))
+		return false
+	}
+
+	groups, err := gh.UserService.Groups(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return false
+	}
+
+	for _, group := range groups {
+		if group.ModuleCode == code {
+			abortWithError(c, conflict(fmt.Sprintf("User %d is already in a %s group", chatID, code)))
+			return false
+		}
+	}
+
+	return true
+}
+
+func withoutMember(members []modwithfriends.ChatID, chatID modwithfriends.ChatID) []modwithfriends.ChatID {
+	remaining := []modwithfriends.ChatID{}
+	for _, member := range members {
+		if member != chatID {
+			remaining = append(remaining, member)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"modwithfriends"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type moduleRequest struct {
+	ModuleCode string `json:"moduleCode"`
+}
+
+type moduleResponse struct {
+	ModuleCode modwithfriends.ModuleCode `json:"moduleCode"`
+}
+
+type modulesHandler struct {
+	Router        *gin.Engine
+	Auth          *authenticator
+	ModuleService modwithfriends.ModuleService
+	Audit         *auditor
+}
+
+func (mh *modulesHandler) register() {
+	v1 := mh.Router.Group("/api/v1/modules")
+
+	v1.GET("/", mh.Auth.require(modwithfriends.ScopeModulesRead), mh.getModules)
+	v1.GET("/:moduleCode", mh.Auth.require(modwithfriends.ScopeModulesRead), mh.getModule)
+	v1.POST("/", mh.Auth.require(modwithfriends.ScopeModulesWrite), mh.createModule)
+	v1.DELETE("/:moduleCode", mh.Auth.require(modwithfriends.ScopeModulesWrite), mh.deleteModule)
+}
+
+func (mh *modulesHandler) getModules(c *gin.Context) {
+	modules, err := mh.ModuleService.Modules()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	res := []moduleResponse{}
+	for _, module := range modules {
+		res = append(res, moduleResponse{module})
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (mh *modulesHandler) getModule(c *gin.Context) {
+	moduleCode, err := parseModuleCode(c.Param("moduleCode"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	exist, err := mh.ModuleService.Exist(moduleCode)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if !exist {
+		abortWithError(c, modwithfriends.ErrEntityNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, moduleResponse{moduleCode})
+}
+
+func (mh *modulesHandler) createModule(c *gin.Context) {
+	req := moduleRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+
+	moduleCode, err := parseModuleCode(req.ModuleCode)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	err = mh.ModuleService.CreateModule(moduleCode)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	mh.Audit.record(c, modwithfriends.AuditModuleCreate, string(moduleCode), nil, moduleResponse{moduleCode})
+
+	c.JSON(http.StatusCreated, moduleResponse{moduleCode})
+}
+
+func (mh *modulesHandler) deleteModule(c *gin.Context) {
+	moduleCode, err := parseModuleCode(c.Param("moduleCode"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	err = mh.ModuleService.DeleteModule(moduleCode)
+	if err == modwithfriends.ErrEntityInUse {
+		abortWithError(c, conflict("Module still has groups, dissolve them first"))
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	mh.Audit.record(c, modwithfriends.AuditModuleDelete, string(moduleCode), moduleResponse{moduleCode}, nil)
+
+	c.Status(http.StatusNoContent)
+}
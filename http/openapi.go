@@ -0,0 +1,143 @@
+package http
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// openAPISpec describes every route in this package, see openapi.yaml.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+func init() {
+	openapi3.DefineStringFormatCallback("uuid", func(s string) error {
+		_, err := uuid.Parse(s)
+		return err
+	})
+	// CSV bodies are parsed by their handlers, the spec only needs them read.
+	openapi3filter.RegisterBodyDecoder("text/csv", openapi3filter.FileBodyDecoder)
+	// Clients only need to know what is wrong, not the whole schema.
+	openapi3.SchemaErrorDetailsDisabled = true
+}
+
+func loadSpec() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load API spec: %w", err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("Failed to validate API spec: %w", err)
+	}
+
+	return doc, nil
+}
+
+// specValidator rejects requests that do not match the API spec before they
+// reach the handlers. Authentication is left to the authenticator.
+type specValidator struct {
+	Router routers.Router
+}
+
+func newSpecValidator(doc *openapi3.T) (*specValidator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to route API spec: %w", err)
+	}
+	return &specValidator{Router: router}, nil
+}
+
+func (v *specValidator) validate(c *gin.Context) {
+	route, params, err := v.Router.FindRoute(c.Request)
+	if err != nil {
+		// Unknown routes are left to gin to answer.
+		c.Next()
+		return
+	}
+
+	err = openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+		Request:    c.Request,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	})
+	if err != nil {
+		abortWithError(c, invalidRequest("Request does not match the API spec, "+err.Error()))
+		return
+	}
+
+	c.Next()
+}
+
+// checkRoutes makes sure that the registered routes and the routes in the API
+// spec are the same, so neither can be changed without the other. Routes that
+// are not part of the API must be listed in undocumented to be left out.
+func checkRoutes(routes gin.RoutesInfo, doc *openapi3.T, undocumented []string) error {
+	registered := map[string]bool{}
+	for _, route := range routes {
+		if isUndocumented(route.Path, undocumented) {
+			continue
+		}
+		registered[route.Method+" "+specPath(route.Path)] = true
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	mismatches := []string{}
+	for route := range registered {
+		if !documented[route] {
+			mismatches = append(mismatches, route+" is not in the API spec")
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			mismatches = append(mismatches, route+" is not registered")
+		}
+	}
+
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return fmt.Errorf("Routes and API spec are out of sync: %s", strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// isUndocumented is whether the path is one of the undocumented paths, or is
+// under one of them that ends with a slash.
+func isUndocumented(path string, undocumented []string) bool {
+	for _, prefix := range undocumented {
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// specPath turns a gin path such as /groups/:groupID into /groups/{groupID}.
+func specPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeTelegramWebhook struct {
+	http.Handler
+}
+
+func (fakeTelegramWebhook) Path() string {
+	return "/telegram/secret"
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	spec, err := loadSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Router: gin.New(), TelegramWebhook: fakeTelegramWebhook{http.NotFoundHandler()}}
+	if err := s.register(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkRoutes(s.Router.Routes(), spec, s.undocumentedRoutes()); err != nil {
+		t.Error(err)
+	}
+
+	// Routes outside /api are only left out of the spec when they are listed.
+	s.Router.GET("/healthz/extra", func(c *gin.Context) {})
+	err = checkRoutes(s.Router.Routes(), spec, s.undocumentedRoutes())
+	if err == nil || !strings.Contains(err.Error(), "GET /healthz/extra is not in the API spec") {
+		t.Errorf("checkRoutes with an unlisted route = %v, want it reported", err)
+	}
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"modwithfriends"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+var (
+	errInvalidCursor = invalidRequest("Please provide a cursor returned by a previous request with the same sort and order")
+	errInvalidLimit  = invalidRequest(fmt.Sprintf("Please provide an integer between 1 and %d for the limit query", maxPageLimit))
+)
+
+var groupStates = map[string]modwithfriends.GroupState{
+	"forming": modwithfriends.GroupStateForming,
+	"full":    modwithfriends.GroupStateFull,
+	"invited": modwithfriends.GroupStateInvited,
+}
+
+var groupSortKeys = map[string]modwithfriends.GroupSortKey{
+	"createdAt": modwithfriends.SortByCreatedAt,
+	"size":      modwithfriends.SortBySize,
+}
+
+// pageCursor is what the opaque cursor handed out to clients decodes to. The
+// sort and order are kept so a cursor cannot be used with a different sort.
+type pageCursor struct {
+	SortBy     modwithfriends.GroupSortKey `json:"sortBy"`
+	Descending bool                        `json:"descending"`
+	modwithfriends.GroupCursor
+}
+
+// parseGroupQuery builds a GroupQuery out of the listing query params:
+//
+//	module         module code
+//	size           member count, compared with sizeCondition
+//	sizeCondition  one of LESS_THAN, LESS_THAN_OR_EQUAL, EQUAL (default), MORE_THAN_OR_EQUAL, MORE_THAN
+//	state          comma separated list of forming, full and invited, defaults to defaultStates
+//	sort           createdAt (default) or size
+//	order          asc (default) or desc
+//	limit          page size, defaults to 50
+//	cursor         X-Next-Cursor header of the previous page
+func parseGroupQuery(c *gin.Context, defaultStates ...modwithfriends.GroupState) (modwithfriends.GroupQuery, error) {
+	query := modwithfriends.GroupQuery{
+		States: defaultStates,
+		SortBy: modwithfriends.SortByCreatedAt,
+		Limit:  defaultPageLimit,
+	}
+
+	if moduleCodeQuery, exist := c.GetQuery("module"); exist {
+		moduleCode, err := parseModuleCode(moduleCodeQuery)
+		if err != nil {
+			return modwithfriends.GroupQuery{}, invalidRequest("Please provide a valid module code for the module query")
+		}
+		query.ModuleCode = &moduleCode
+	}
+
+	if sizeQuery, exist := c.GetQuery("size"); exist {
+		size, err := strconv.Atoi(sizeQuery)
+		if err != nil {
+			return modwithfriends.GroupQuery{}, invalidRequest("Please provide a valid integer for the size query")
+		}
+
+		condition := modwithfriends.NumericComparator(c.DefaultQuery("sizeCondition", string(modwithfriends.Equal)))
+		if !isValidComparator(condition) {
+			return modwithfriends.GroupQuery{}, invalidRequest(fmt.Sprintf("Please provide one of %v for the sizeCondition query", modwithfriends.NumericComparators))
+		}
+
+		query.MemberCriteriaQuery = &modwithfriends.MemberCriteriaQuery{
+			Condition: condition,
+			Count:     size,
+		}
+	}
+
+	if stateQuery, exist := c.GetQuery("state"); exist {
+		query.States = []modwithfriends.GroupState{}
+		for _, name := range strings.Split(stateQuery, ",") {
+			state, ok := groupStates[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				return modwithfriends.GroupQuery{}, invalidRequest("Please provide a comma separated list of forming, full or invited for the state query")
+			}
+			query.States = append(query.States, state)
+		}
+	}
+
+	if sortQuery, exist := c.GetQuery("sort"); exist {
+		sortBy, ok := groupSortKeys[sortQuery]
+		if !ok {
+			return modwithfriends.GroupQuery{}, invalidRequest("Please provide either createdAt or size for the sort query")
+		}
+		query.SortBy = sortBy
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return modwithfriends.GroupQuery{}, invalidRequest("Please provide either asc or desc for the order query")
+	}
+
+	if limitQuery, exist := c.GetQuery("limit"); exist {
+		limit, err := strconv.Atoi(limitQuery)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return modwithfriends.GroupQuery{}, errInvalidLimit
+		}
+		query.Limit = limit
+	}
+
+	if cursorQuery, exist := c.GetQuery("cursor"); exist {
+		cursor, err := decodeCursor(cursorQuery)
+		if err != nil || cursor.SortBy != query.SortBy || cursor.Descending != query.Descending {
+			return modwithfriends.GroupQuery{}, errInvalidCursor
+		}
+		query.After = &cursor.GroupCursor
+	}
+
+	return query, nil
+}
+
+// setNextCursor tells the client where the next page starts, if there may be one.
+func setNextCursor(c *gin.Context, query modwithfriends.GroupQuery, groups []modwithfriends.Group) {
+	if query.Limit == 0 || len(groups) < query.Limit {
+		return
+	}
+
+	cursor, err := encodeCursor(pageCursor{
+		SortBy:      query.SortBy,
+		Descending:  query.Descending,
+		GroupCursor: modwithfriends.NewGroupCursor(groups[len(groups)-1]),
+	})
+	if err != nil {
+		return
+	}
+
+	c.Header(nextCursorHeader, cursor)
+}
+
+func encodeCursor(cursor pageCursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(str string) (pageCursor, error) {
+	cursor := pageCursor{}
+
+	b, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("Failed to decode cursor: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return pageCursor{}, fmt.Errorf("Failed to decode cursor: %w", err)
+	}
+
+	return cursor, nil
+}
+
+func isValidComparator(comparator modwithfriends.NumericComparator) bool {
+	for _, c := range modwithfriends.NumericComparators {
+		if c == comparator {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"modwithfriends"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRateLimit      = 5
+	defaultRateLimitBurst = 30
+	bucketSweepInterval   = time.Minute
+)
+
+// RateLimit configures how many requests each client IP can make. Client IPs
+// are as resolved by clientIPs, so that they cannot be forged.
+type RateLimit struct {
+	// Rate is the number of requests per second a client can keep up.
+	Rate float64
+	// Burst is the number of requests a client can make at once.
+	Burst int
+	// Banned lists IP addresses and CIDR ranges whose requests are refused.
+	Banned []string
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// keyChecked tells whether a key was looked up since the bucket ran out,
+	// and adminKey is the hash of the admin key it let through, so that a
+	// limited client cannot have a key looked up on every request.
+	keyChecked bool
+	adminKey   string
+}
+
+// rateLimiter gives every client IP a token bucket that refills at the
+// configured rate. Requests with an API key bearing the keys:admin scope are
+// let through once the bucket runs out, and requests to exempt routes are not
+// limited, but banned IPs are refused no matter what.
+type rateLimiter struct {
+	RateLimit
+	Auth *authenticator
+
+	banned    []*net.IPNet
+	exempted  map[string]bool
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(config RateLimit, auth *authenticator) (*rateLimiter, error) {
+	if config.Rate <= 0 {
+		config.Rate = defaultRateLimit
+	}
+	if config.Burst <= 0 {
+		config.Burst = defaultRateLimitBurst
+	}
+
+	banned, err := parseIPNets(config.Banned)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse banned IPs: %w", err)
+	}
+
+	return &rateLimiter{
+		RateLimit: config,
+		Auth:      auth,
+		banned:    banned,
+		exempted:  map[string]bool{},
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func (rl *rateLimiter) limit(c *gin.Context) {
+	ip := clientIP(c)
+	if rl.isBanned(ip) {
+		abortWithError(c, &apiError{http.StatusForbidden, codeForbidden, "Your IP address has been banned"})
+		return
+	}
+
+	if rl.exempted[c.FullPath()] {
+		c.Next()
+		return
+	}
+
+	remaining, reset, retryAfter, ok := rl.take(ip, time.Now())
+
+	c.Header("RateLimit-Limit", strconv.Itoa(rl.Burst))
+	c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(reset))
+
+	// Keys are only looked up once the bucket is empty, so that requests
+	// within the limit cost no more than a token.
+	if !ok && !rl.bypass(c, ip) {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		abortWithError(c, &apiError{http.StatusTooManyRequests, codeRateLimited, "Too many requests, please slow down"})
+		return
+	}
+
+	c.Next()
+}
+
+// exempt stops requests to the route from being limited, e.g. for Telegram
+// pushing updates to the bot, which comes from a handful of IPs.
+func (rl *rateLimiter) exempt(path string) {
+	rl.exempted[path] = true
+}
+
+func (rl *rateLimiter) isBanned(ip string) bool {
+	return containsIP(rl.banned, ip)
+}
+
+// bypass lets admins through, looking up at most one key for each time the
+// ip's bucket runs out. The shared password is limited like everyone else.
+func (rl *rateLimiter) bypass(c *gin.Context, ip string) bool {
+	secret := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return false
+	}
+	hash := hashAPIKey(secret)
+
+	rl.mu.Lock()
+	b, ok := rl.buckets[ip]
+	if !ok {
+		rl.mu.Unlock()
+		return false
+	}
+	checked, admin := b.keyChecked, b.adminKey == hash
+	b.keyChecked = true
+	rl.mu.Unlock()
+
+	if admin {
+		return true
+	}
+	if checked {
+		return false
+	}
+
+	key, ok := rl.Auth.authenticate(c)
+	if !ok || key.ID == "" || !key.HasScope(modwithfriends.ScopeKeysAdmin) {
+		return false
+	}
+
+	rl.mu.Lock()
+	b.adminKey = hash
+	rl.mu.Unlock()
+	return true
+}
+
+// take spends a token of the ip's bucket if there is one. It returns the
+// tokens left, the seconds until the bucket is full again and, when there is
+// no token, the seconds until there is one.
+func (rl *rateLimiter) take(ip string, now time.Time) (int, int, int, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	b, ok := rl.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: float64(rl.Burst), updatedAt: now}
+		rl.buckets[ip] = b
+	}
+
+	b.tokens = math.Min(float64(rl.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*rl.Rate)
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+		b.keyChecked, b.adminKey = false, ""
+	}
+
+	reset := int(math.Ceil((float64(rl.Burst) - b.tokens) / rl.Rate))
+	retryAfter := int(math.Ceil((1 - b.tokens) / rl.Rate))
+
+	return int(b.tokens), reset, retryAfter, allowed
+}
+
+// sweep forgets the buckets that have refilled, as a new bucket is no
+// different.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < bucketSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+
+	refill := time.Duration(float64(rl.Burst) / rl.Rate * float64(time.Second))
+	for ip, b := range rl.buckets {
+		if now.Sub(b.updatedAt) >= refill {
+			delete(rl.buckets, ip)
+		}
+	}
+}
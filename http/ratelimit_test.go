@@ -0,0 +1,112 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newLimitedRouter(t *testing.T, config RateLimit, trustedProxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	clientIPs, err := newClientIPs(trustedProxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter, err := newRateLimiter(config, &authenticator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(clientIPs.resolve, limiter.limit)
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, clientIP(c))
+	})
+	return router
+}
+
+func get(router *gin.Engine, remoteAddr string, forwardedFor ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for _, header := range forwardedFor {
+		req.Header.Add(forwardedForHeader, header)
+	}
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	router := newLimitedRouter(t, RateLimit{Rate: 1, Burst: 1}, nil)
+
+	if res := get(router, "203.0.113.7:5000", "198.51.100.1"); res.Code != http.StatusOK {
+		t.Fatalf("first request got %d, want %d", res.Code, http.StatusOK)
+	}
+	if res := get(router, "203.0.113.7:5000", "198.51.100.2"); res.Code != http.StatusTooManyRequests {
+		t.Errorf("request with a forged X-Forwarded-For got %d, want %d", res.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitBansForgedForwardedFor(t *testing.T) {
+	router := newLimitedRouter(t, RateLimit{Banned: []string{"203.0.113.0/24"}}, []string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}},
+		{name: "through proxy", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1, 203.0.113.7"}},
+		{name: "through proxies", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1", "203.0.113.7, 10.4.5.6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := get(router, tt.remoteAddr, tt.forwardedFor...); res.Code != http.StatusForbidden {
+				t.Errorf("banned IP got %d, want %d", res.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	clientIPs, err := newClientIPs([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{name: "no proxy", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted remote", remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted remote", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "rightmost untrusted hop", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1, 203.0.113.7, 10.4.5.6"}, want: "203.0.113.7"},
+		{name: "headers joined", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "ipv6 proxy", remoteAddr: "[2001:db8::1]:5000", forwardedFor: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "only proxies", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"10.4.5.6"}, want: "10.4.5.6"},
+		{name: "no header", remoteAddr: "10.1.2.3:5000", want: "10.1.2.3"},
+		{name: "garbage hop", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"203.0.113.7, nonsense"}, want: "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwardedFor {
+				req.Header.Add(forwardedForHeader, header)
+			}
+
+			if got := clientIPs.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
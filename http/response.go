@@ -1,9 +0,0 @@
-package http
-
-type standardResponse struct {
-	Message string `json:"message"`
-}
-
-func newStandardResponse(msg string) standardResponse {
-	return standardResponse{msg}
-}
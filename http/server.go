@@ -1,37 +1,210 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"modwithfriends"
+	"modwithfriends/webhooks"
+	"net/http"
+	"sync"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
 )
 
 // Server ...
 type Server struct {
-	Port         int
-	Router       *gin.Engine
-	Bot          modwithfriends.Bot
-	UserService  modwithfriends.UserService
-	GroupService modwithfriends.GroupService
-	Pwd          string
+	Port               int
+	Router             *gin.Engine
+	Bot                modwithfriends.Bot
+	TelegramWebhook    modwithfriends.TelegramWebhook
+	Database           modwithfriends.Database
+	Notifier           modwithfriends.Notifier
+	UserService        modwithfriends.UserService
+	GroupService       modwithfriends.GroupService
+	ModuleService      modwithfriends.ModuleService
+	BroadcastService   modwithfriends.BroadcastService
+	EmailService       modwithfriends.EmailService
+	APIKeyService      modwithfriends.APIKeyService
+	StatsService       modwithfriends.StatsService
+	GroupEvents        modwithfriends.GroupEventSubscriber
+	WebhookService     modwithfriends.WebhookService
+	AdminService       modwithfriends.AdminService
+	IdempotencyService modwithfriends.IdempotencyService
+	AuditService       modwithfriends.AuditService
+	RateLimit          RateLimit
+	TrustedProxies     []string
+	Webhooks           *webhooks.Dispatcher
+	AdminEmail         string
+	Pwd                string
+
+	mu      sync.Mutex
+	server  *http.Server
+	closing chan struct{}
 }
 
 // Start ...
 func (s *Server) Start() {
+	spec, err := loadSpec()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := s.register(spec); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := checkRoutes(s.Router.Routes(), spec, s.undocumentedRoutes()); err != nil {
+		log.Fatal(err)
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.closing:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.Port),
+		Handler: s.Router,
+	}
+	s.mu.Unlock()
+
+	err = s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// register adds the middleware and every handler to the router, validating
+// requests against the spec.
+func (s *Server) register(spec *openapi3.T) error {
+	validator, err := newSpecValidator(spec)
+	if err != nil {
+		return err
+	}
+
+	auth := &authenticator{
+		APIKeyService: s.APIKeyService,
+		Pwd:           s.Pwd,
+	}
+
+	clientIPs, err := newClientIPs(s.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	limiter, err := newRateLimiter(s.RateLimit, auth)
+	if err != nil {
+		return err
+	}
+	// The admin dashboard and the event stream are limited like the API: the
+	// dashboard's login is what most needs it, and a stream only costs a
+	// token each time it is opened.
+	if s.TelegramWebhook != nil {
+		limiter.exempt(s.TelegramWebhook.Path())
+	}
+
+	s.Router.Use(withRequestID, clientIPs.resolve, gin.CustomRecovery(handlePanic), limiter.limit, validator.validate)
+	s.Router.NoRoute(handleNoRoute)
+
+	idempotency := &idempotency{
+		IdempotencyService: s.IdempotencyService,
+	}
+
+	audit := &auditor{
+		AuditService: s.AuditService,
+	}
+
+	broadcaster := &broadcaster{
+		Bot:              s.Bot,
+		Notifier:         s.Notifier,
+		UserService:      s.UserService,
+		BroadcastService: s.BroadcastService,
+		EmailService:     s.EmailService,
+		AdminEmail:       s.AdminEmail,
+	}
+
 	handlers := []handler{
 		&groupsHandler{
-			Router:       s.Router,
-			Bot:          s.Bot,
-			UserService:  s.UserService,
-			GroupService: s.GroupService,
-			Pwd:          s.Pwd,
+			Router:        s.Router,
+			Broadcaster:   broadcaster,
+			UserService:   s.UserService,
+			GroupService:  s.GroupService,
+			ModuleService: s.ModuleService,
+			Auth:          auth,
+			Idempotency:   idempotency,
+			Audit:         audit,
 		},
 		&magicHandler{
 			Router:      s.Router,
-			Bot:         s.Bot,
+			Broadcaster: broadcaster,
+			Auth:        auth,
+			Audit:       audit,
+		},
+		&usersHandler{
+			Router:      s.Router,
+			Auth:        auth,
 			UserService: s.UserService,
-			Pwd:         s.Pwd,
+			Audit:       audit,
+		},
+		&modulesHandler{
+			Router:        s.Router,
+			Auth:          auth,
+			ModuleService: s.ModuleService,
+			Audit:         audit,
+		},
+		&keysHandler{
+			Router:        s.Router,
+			Auth:          auth,
+			APIKeyService: s.APIKeyService,
+			Audit:         audit,
+		},
+		&auditHandler{
+			Router:       s.Router,
+			Auth:         auth,
+			AuditService: s.AuditService,
+		},
+		&webhooksHandler{
+			Router:         s.Router,
+			Auth:           auth,
+			WebhookService: s.WebhookService,
+			Dispatcher:     s.Webhooks,
+			Audit:          audit,
+		},
+		&statsHandler{
+			Router:       s.Router,
+			StatsService: s.StatsService,
+		},
+		&eventsHandler{
+			Router:     s.Router,
+			Subscriber: s.GroupEvents,
+			Closing:    s.closingChan(),
+		},
+		&docsHandler{
+			Router: s.Router,
+		},
+		&telegramHandler{
+			Router:  s.Router,
+			Webhook: s.TelegramWebhook,
+		},
+		&healthHandler{
+			Router:   s.Router,
+			Database: s.Database,
+			Bot:      s.Bot,
+			Auth:     auth,
+		},
+		&adminHandler{
+			Router:       s.Router,
+			AdminService: s.AdminService,
+			GroupService: s.GroupService,
+			UserService:  s.UserService,
+			Bot:          s.Bot,
+			Broadcaster:  broadcaster,
+			Audit:        audit,
 		},
 	}
 
@@ -39,5 +212,47 @@ func (s *Server) Start() {
 		h.register()
 	}
 
-	s.Router.Run(fmt.Sprintf(":%d", s.Port))
+	return nil
+}
+
+// undocumentedRoutes are the routes left out of the API spec as they are not
+// for API clients: the admin dashboard, the probes and metrics scraped by the
+// platform, and the path Telegram pushes updates to, which is kept secret.
+func (s *Server) undocumentedRoutes() []string {
+	routes := []string{"/admin/", "/healthz", "/readyz", "/metrics"}
+	if s.TelegramWebhook != nil {
+		routes = append(routes, s.TelegramWebhook.Path())
+	}
+	return routes
+}
+
+// Shutdown stops taking requests and waits until ctx is done for the ones
+// being served, ending event streams as they would otherwise never finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	closing := s.closingChan()
+
+	s.mu.Lock()
+	close(closing)
+	server := s.server
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("Failed to finish serving requests: %w", err)
+	}
+	return nil
+}
+
+// closingChan is closed once the server starts shutting down.
+func (s *Server) closingChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing == nil {
+		s.closing = make(chan struct{})
+	}
+	return s.closing
 }
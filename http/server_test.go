@@ -0,0 +1,78 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestServerClientIPBehindProxy serves the router the way Start does, so that
+// clients behind a trusted proxy keep buckets of their own rather than share
+// the proxy's.
+func TestServerClientIPBehindProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	spec, err := loadSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		Router:         gin.New(),
+		RateLimit:      RateLimit{Rate: 0.001, Burst: 1},
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+	}
+	if err := s.register(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.Router)
+	defer ts.Close()
+
+	status := func(forwardedFor string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/nowhere", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(forwardedForHeader, forwardedFor)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if got := status("198.51.100.1"); got == http.StatusTooManyRequests {
+		t.Fatalf("first client was limited on its first request")
+	}
+	if got := status("198.51.100.2"); got == http.StatusTooManyRequests {
+		t.Errorf("second client shared the first client's bucket")
+	}
+	if got := status("198.51.100.1"); got != http.StatusTooManyRequests {
+		t.Errorf("first client's second request got %d, want %d", got, http.StatusTooManyRequests)
+	}
+}
+
+func TestServerMetricsRequireAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	spec, err := loadSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Router: gin.New()}
+	if err := s.register(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	s.Router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("GET /metrics without an API key got %d, want %d", res.Code, http.StatusUnauthorized)
+	}
+}
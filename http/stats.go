@@ -0,0 +1,68 @@
+package http
+
+import (
+	"fmt"
+	"modwithfriends"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	statsTTL       = 1 * time.Minute
+	trendingWindow = 7 * 24 * time.Hour
+	trendingLimit  = 10
+)
+
+// statsHandler serves public stats for the fwens website. The stats are
+// cached for a short while as every visit to the landing page asks for them.
+type statsHandler struct {
+	Router       *gin.Engine
+	StatsService modwithfriends.StatsService
+
+	mu        sync.Mutex
+	stats     modwithfriends.Stats
+	expiresAt time.Time
+}
+
+func (sh *statsHandler) register() {
+	sh.Router.GET("/api/v1/stats", sh.getStats)
+}
+
+func (sh *statsHandler) getStats(c *gin.Context) {
+	stats, expiresAt, err := sh.cachedStats(time.Now())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	c.JSON(http.StatusOK, stats)
+}
+
+// cachedStats returns the cached stats, recomputing them once they expire.
+// Requests wait on the one recomputing them rather than all hitting the
+// database at once.
+func (sh *statsHandler) cachedStats(now time.Time) (modwithfriends.Stats, time.Time, error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if now.Before(sh.expiresAt) {
+		return sh.stats, sh.expiresAt, nil
+	}
+
+	stats, err := sh.StatsService.Stats(now.Add(-trendingWindow), trendingLimit)
+	if err != nil {
+		return modwithfriends.Stats{}, time.Time{}, err
+	}
+
+	sh.stats = stats
+	sh.expiresAt = now.Add(statsTTL)
+	return sh.stats, sh.expiresAt, nil
+}
@@ -0,0 +1,22 @@
+package http
+
+import (
+	"modwithfriends"
+
+	"github.com/gin-gonic/gin"
+)
+
+// telegramHandler receives the updates Telegram pushes to the bot when it is
+// in webhook mode.
+type telegramHandler struct {
+	Router  *gin.Engine
+	Webhook modwithfriends.TelegramWebhook
+}
+
+func (th *telegramHandler) register() {
+	if th.Webhook == nil {
+		return
+	}
+
+	th.Router.POST(th.Webhook.Path(), gin.WrapH(th.Webhook))
+}
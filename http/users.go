@@ -0,0 +1,227 @@
+package http
+
+import (
+	"modwithfriends"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type userRequest struct {
+	ChatID modwithfriends.ChatID `json:"chatId"`
+}
+
+type updateUserRequest struct {
+	Email  *string `json:"email"`
+	Active *bool   `json:"active"`
+}
+
+type userResponse struct {
+	ChatID modwithfriends.ChatID  `json:"chatId"`
+	Email  *string                `json:"email"`
+	Groups []modwithfriends.Group `json:"groups"`
+}
+
+type usersHandler struct {
+	Router      *gin.Engine
+	Auth        *authenticator
+	UserService modwithfriends.UserService
+	Audit       *auditor
+}
+
+func (uh *usersHandler) register() {
+	v1 := uh.Router.Group("/api/v1/users")
+
+	v1.GET("/", uh.Auth.require(modwithfriends.ScopeUsersRead), uh.getUsers)
+	v1.GET("/:userID", uh.Auth.require(modwithfriends.ScopeUsersRead), uh.getUser)
+	v1.GET("/:userID/groups", uh.Auth.require(modwithfriends.ScopeUsersRead, modwithfriends.ScopeGroupsRead), uh.getUserGroups)
+	v1.POST("/", uh.Auth.require(modwithfriends.ScopeUsersWrite), uh.createUser)
+	v1.PATCH("/:userID", uh.Auth.require(modwithfriends.ScopeUsersWrite), uh.updateUser)
+	v1.DELETE("/:userID", uh.Auth.require(modwithfriends.ScopeUsersWrite), uh.deleteUser)
+}
+
+func (uh *usersHandler) getUsers(c *gin.Context) {
+	users, err := uh.UserService.Users()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (uh *usersHandler) getUser(c *gin.Context) {
+	chatID, ok := uh.existingUser(c)
+	if !ok {
+		return
+	}
+
+	user, err := uh.user(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (uh *usersHandler) getUserGroups(c *gin.Context) {
+	chatID, ok := uh.existingUser(c)
+	if !ok {
+		return
+	}
+
+	groups, err := uh.UserService.Groups(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+func (uh *usersHandler) createUser(c *gin.Context) {
+	req := userRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChatID == 0 {
+		abortWithError(c, errInvalidChatID)
+		return
+	}
+
+	err := uh.UserService.CreateUser(req.ChatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	user := userResponse{
+		ChatID: req.ChatID,
+		Groups: []modwithfriends.Group{},
+	}
+	uh.Audit.record(c, modwithfriends.AuditUserCreate, strconv.Itoa(int(req.ChatID)), nil, user)
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// updateUser changes a user's email and whether they are active. Deactivating
+// a user takes them out of their forming groups, the same as when they block
+// the bot.
+func (uh *usersHandler) updateUser(c *gin.Context) {
+	chatID, ok := uh.existingUser(c)
+	if !ok {
+		return
+	}
+
+	req := updateUserRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errInvalidBody)
+		return
+	}
+
+	previous, err := uh.user(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	if req.Email != nil {
+		email := req.Email
+		if *email == "" {
+			email = nil
+		} else if addr, err := mail.ParseAddress(*email); err != nil || addr.Address != *email {
+			abortWithError(c, invalidRequest("Please provide a valid email"))
+			return
+		}
+
+		err := uh.UserService.UpdateEmail(chatID, email)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+
+	if req.Active != nil {
+		var err error
+		if *req.Active {
+			err = uh.UserService.ActivateUser(chatID)
+		} else {
+			err = uh.UserService.DeactivateUser(chatID)
+		}
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+
+	user, err := uh.user(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	uh.Audit.record(c, modwithfriends.AuditUserUpdate, strconv.Itoa(int(chatID)), previous, user)
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (uh *usersHandler) deleteUser(c *gin.Context) {
+	chatID, err := parseChatID(c.Param("userID"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	previous, err := uh.user(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	err = uh.UserService.DeleteUser(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	uh.Audit.record(c, modwithfriends.AuditUserDelete, strconv.Itoa(int(chatID)), previous, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+func (uh *usersHandler) user(chatID modwithfriends.ChatID) (userResponse, error) {
+	email, err := uh.UserService.Email(chatID)
+	if err != nil {
+		return userResponse{}, err
+	}
+
+	groups, err := uh.UserService.Groups(chatID)
+	if err != nil {
+		return userResponse{}, err
+	}
+
+	return userResponse{
+		ChatID: chatID,
+		Email:  email,
+		Groups: groups,
+	}, nil
+}
+
+// existingUser parses the userID param and aborts unless the user exists.
+func (uh *usersHandler) existingUser(c *gin.Context) (modwithfriends.ChatID, bool) {
+	chatID, err := parseChatID(c.Param("userID"))
+	if err != nil {
+		abortWithError(c, err)
+		return 0, false
+	}
+
+	exist, err := uh.UserService.Exist(chatID)
+	if err != nil {
+		abortWithError(c, err)
+		return 0, false
+	}
+	if !exist {
+		abortWithError(c, modwithfriends.ErrEntityNotFound)
+		return 0, false
+	}
+
+	return chatID, true
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"modwithfriends"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errInvalidBody        = invalidRequest("Please provide a valid JSON body")
+	errInvalidChatID      = invalidRequest("Please provide a valid integer for the user ID")
+	errInvalidModuleCode  = invalidRequest("Please provide a valid module code")
+	errInvalidGroupID     = invalidRequest("Please provide a valid UUID for the group ID")
+	errInvalidBroadcastID = invalidRequest("Please provide a valid UUID for the broadcast ID")
+	errInvalidAPIKeyID    = invalidRequest("Please provide a valid UUID for the API key ID")
+	errInvalidWebhookID   = invalidRequest("Please provide a valid UUID for the webhook ID")
+	errInvalidInviteLink  = invalidRequest("Please provide an https invite link")
+)
+
+func parseChatID(str string) (modwithfriends.ChatID, error) {
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, errInvalidChatID
+	}
+	return modwithfriends.ChatID(val), nil
+}
+
+// parseModuleCode cleans up a module code the same way the bot does.
+func parseModuleCode(str string) (modwithfriends.ModuleCode, error) {
+	code := strings.ReplaceAll(strings.ToUpper(str), " ", "")
+	if code == "" {
+		return "", errInvalidModuleCode
+	}
+	return modwithfriends.ModuleCode(code), nil
+}
+
+func parseGroupID(str string) (string, error) {
+	return parseUUID(str, errInvalidGroupID)
+}
+
+func parseBroadcastID(str string) (string, error) {
+	return parseUUID(str, errInvalidBroadcastID)
+}
+
+func parseAPIKeyID(str string) (string, error) {
+	return parseUUID(str, errInvalidAPIKeyID)
+}
+
+func parseWebhookID(str string) (string, error) {
+	return parseUUID(str, errInvalidWebhookID)
+}
+
+// parseUUID checks that an ID is a UUID before it goes to the database, which
+// would fail to compare it with its UUID columns otherwise.
+func parseUUID(str string, errInvalid *apiError) (string, error) {
+	if _, err := uuid.Parse(str); err != nil {
+		return "", errInvalid
+	}
+	return str, nil
+}
+
+func parseInviteLink(str string) (string, error) {
+	link := strings.TrimSpace(str)
+	if u, err := url.Parse(link); err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", errInvalidInviteLink
+	}
+	return link, nil
+}
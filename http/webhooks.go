@@ -0,0 +1,179 @@
+package http
+
+import (
+	"modwithfriends"
+	"modwithfriends/webhooks"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+const deliveriesLimit = 100
+
+type webhookRequest struct {
+	URL    string                        `json:"url"`
+	Events []modwithfriends.WebhookEvent `json:"events"`
+}
+
+type webhookResponse struct {
+	modwithfriends.Webhook
+	Secret string `json:"secret"`
+}
+
+type pingResponse struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type webhooksHandler struct {
+	Router         *gin.Engine
+	Auth           *authenticator
+	WebhookService modwithfriends.WebhookService
+	Dispatcher     *webhooks.Dispatcher
+	Audit          *auditor
+}
+
+func (wh *webhooksHandler) register() {
+	v0 := wh.Router.Group("/api/v0/webhooks", wh.Auth.require(modwithfriends.ScopeWebhooksAdmin))
+
+	v0.GET("/", wh.getWebhooks)
+	v0.POST("/", wh.createWebhook)
+	v0.DELETE("/:webhookID", wh.deleteWebhook)
+	v0.GET("/:webhookID/deliveries", wh.getDeliveries)
+	v0.POST("/:webhookID/test", wh.testWebhook)
+}
+
+func (wh *webhooksHandler) getWebhooks(c *gin.Context) {
+	hooks, err := wh.WebhookService.Webhooks()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// createWebhook registers a webhook, its secret is only ever shown here.
+func (wh *webhooksHandler) createWebhook(c *gin.Context) {
+	req := webhookRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Events) == 0 {
+		abortWithError(c, invalidRequest("Please provide a url and at least one event for the webhook"))
+		return
+	}
+
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		abortWithError(c, invalidRequest("Please provide an absolute http or https url for the webhook"))
+		return
+	}
+
+	for _, event := range req.Events {
+		if !isValidWebhookEvent(event) {
+			abortWithError(c, invalidRequest("Unknown event: "+string(event)))
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	webhookID, err := wh.WebhookService.CreateWebhook(modwithfriends.Webhook{
+		URL:    req.URL,
+		Secret: secret,
+		Events: req.Events,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	hook, err := wh.WebhookService.Webhook(webhookID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	wh.Audit.record(c, modwithfriends.AuditWebhookCreate, hook.ID, nil, hook)
+
+	c.JSON(http.StatusCreated, webhookResponse{Webhook: hook, Secret: secret})
+}
+
+func (wh *webhooksHandler) deleteWebhook(c *gin.Context) {
+	hook, ok := wh.existingWebhook(c, c.Param("webhookID"))
+	if !ok {
+		return
+	}
+
+	err := wh.WebhookService.DeleteWebhook(hook.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	wh.Audit.record(c, modwithfriends.AuditWebhookDelete, hook.ID, hook, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// getDeliveries lists the latest deliveries to a webhook along with the
+// outcome of their last attempt.
+func (wh *webhooksHandler) getDeliveries(c *gin.Context) {
+	hook, ok := wh.existingWebhook(c, c.Param("webhookID"))
+	if !ok {
+		return
+	}
+
+	deliveries, err := wh.WebhookService.Deliveries(hook.ID, deliveriesLimit)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// testWebhook sends a ping to the webhook and reports how it responded.
+func (wh *webhooksHandler) testWebhook(c *gin.Context) {
+	hook, ok := wh.existingWebhook(c, c.Param("webhookID"))
+	if !ok {
+		return
+	}
+
+	statusCode, err := wh.Dispatcher.Ping(hook)
+
+	res := pingResponse{Delivered: err == nil, StatusCode: statusCode}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// existingWebhook aborts unless webhookID is a valid ID of an existing webhook.
+func (wh *webhooksHandler) existingWebhook(c *gin.Context, webhookID string) (modwithfriends.Webhook, bool) {
+	webhookID, err := parseWebhookID(webhookID)
+	if err != nil {
+		abortWithError(c, err)
+		return modwithfriends.Webhook{}, false
+	}
+
+	hook, err := wh.WebhookService.Webhook(webhookID)
+	if err != nil {
+		abortWithError(c, err)
+		return modwithfriends.Webhook{}, false
+	}
+
+	return hook, true
+}
+
+func isValidWebhookEvent(event modwithfriends.WebhookEvent) bool {
+	for _, e := range modwithfriends.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
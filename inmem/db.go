@@ -0,0 +1,132 @@
+// Package inmem keeps users, modules and groups in memory, standing in for the
+// sqlstore services in tests and in code that needs only those. It behaves as
+// the sqlstore package does, down to its constraints, which the servicetest
+// package checks.
+package inmem
+
+import (
+	"modwithfriends"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DB is what the services share, the way the postgres services share a
+// database. Nothing is kept once the process exits.
+type DB struct {
+	mu      sync.Mutex
+	users   map[modwithfriends.ChatID]*user
+	modules map[modwithfriends.ModuleCode]modwithfriends.Model
+	groups  map[string]*modwithfriends.Group
+	// memberships holds when each member joined, by group.
+	memberships map[string]map[modwithfriends.ChatID]time.Time
+}
+
+type user struct {
+	email  *string
+	active bool
+	modwithfriends.Model
+}
+
+func NewDB() *DB {
+	return &DB{
+		users:       map[modwithfriends.ChatID]*user{},
+		modules:     map[modwithfriends.ModuleCode]modwithfriends.Model{},
+		groups:      map[string]*modwithfriends.Group{},
+		memberships: map[string]map[modwithfriends.ChatID]time.Time{},
+	}
+}
+
+// now is the time at Postgres' precision, taken once per change as Postgres
+// does once per transaction.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// members are the group's members in the order they joined.
+func (db *DB) members(groupID string) []modwithfriends.ChatID {
+	joined := db.memberships[groupID]
+
+	members := make([]modwithfriends.ChatID, 0, len(joined))
+	for member := range joined {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := joined[members[i]], joined[members[j]]
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return members[i] < members[j]
+	})
+
+	return members
+}
+
+// group is a copy of the group along with its members, so that callers
+// cannot change what is kept.
+func (db *DB) group(groupID string) modwithfriends.Group {
+	group := *db.groups[groupID]
+	if group.InviteLink != nil {
+		inviteLink := *group.InviteLink
+		group.InviteLink = &inviteLink
+	}
+	group.Members = db.members(groupID)
+	return group
+}
+
+func (db *DB) inviteLinkTaken(inviteLink string, exceptGroupID string) bool {
+	for id, group := range db.groups {
+		if id != exceptGroupID && group.InviteLink != nil && *group.InviteLink == inviteLink {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DB) deleteGroup(groupID string) {
+	delete(db.groups, groupID)
+	delete(db.memberships, groupID)
+}
+
+// backfillGroup moves the longest waiting member of the smallest other forming
+// group of the same module into group, provided that group is smaller than
+// it. Taking from a group as large would only move the empty seat there.
+// Groups left without members are removed.
+func (db *DB) backfillGroup(groupID string, at time.Time) {
+	memberCount := len(db.memberships[groupID])
+	if memberCount == 0 {
+		db.deleteGroup(groupID)
+		return
+	}
+
+	group := db.groups[groupID]
+	var donor *modwithfriends.Group
+	for id, candidate := range db.groups {
+		count := len(db.memberships[id])
+		if id == groupID || candidate.InviteLink != nil || candidate.ModuleCode != group.ModuleCode ||
+			count == 0 || count >= memberCount {
+			continue
+		}
+
+		if donor == nil {
+			donor = candidate
+			continue
+		}
+		donorCount := len(db.memberships[donor.ID])
+		if count < donorCount || (count == donorCount && candidate.CreatedAt.After(donor.CreatedAt)) {
+			donor = candidate
+		}
+	}
+	if donor == nil {
+		return
+	}
+
+	member := db.members(donor.ID)[0]
+	db.memberships[groupID][member] = db.memberships[donor.ID][member]
+	delete(db.memberships[donor.ID], member)
+	group.UpdatedAt = at
+
+	if len(db.memberships[donor.ID]) == 0 {
+		db.deleteGroup(donor.ID)
+	}
+}
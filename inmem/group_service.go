@@ -0,0 +1,344 @@
+package inmem
+
+import (
+	"errors"
+	"fmt"
+	"modwithfriends"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GroupService struct {
+	DB *DB
+}
+
+func (gs *GroupService) Groups() ([]modwithfriends.Group, error) {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	groups := []modwithfriends.Group{}
+	for groupID := range gs.DB.groups {
+		groups = append(groups, gs.DB.group(groupID))
+	}
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func (gs *GroupService) Group(groupID string) (modwithfriends.Group, error) {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	if _, exist := gs.DB.groups[groupID]; !exist {
+		return modwithfriends.Group{}, modwithfriends.ErrEntityNotFound
+	}
+
+	return gs.DB.group(groupID), nil
+}
+
+func (gs *GroupService) GroupsBy(query modwithfriends.GroupQuery) ([]modwithfriends.Group, error) {
+	if query.MemberCriteriaQuery != nil {
+		if _, err := query.MemberCriteriaQuery.String(); err != nil {
+			return nil, fmt.Errorf("Failed to generate query for groups by member criteria: %w", err)
+		}
+	}
+	for _, state := range query.States {
+		if !validState(state) {
+			return nil, errors.New("Failed to generate query for groups by state: Group state is invalid")
+		}
+	}
+	if query.SortBy != "" && query.SortBy != modwithfriends.SortByCreatedAt && query.SortBy != modwithfriends.SortBySize {
+		return nil, errors.New("Failed to generate query for groups as sort key is invalid")
+	}
+
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	groups := []modwithfriends.Group{}
+	for groupID := range gs.DB.groups {
+		group := gs.DB.group(groupID)
+		if matchesQuery(group, query) {
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return compareGroups(groups[i], modwithfriends.NewGroupCursor(groups[j]), query.SortBy) < 0
+	})
+	if query.Descending {
+		for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+			groups[i], groups[j] = groups[j], groups[i]
+		}
+	}
+
+	if query.Limit > 0 && len(groups) > query.Limit {
+		groups = groups[:query.Limit]
+	}
+
+	return groups, nil
+}
+
+func (gs *GroupService) CreateGroup(g modwithfriends.Group) (string, error) {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	if _, exist := gs.DB.modules[g.ModuleCode]; !exist {
+		return "", fmt.Errorf("Failed to add new group: module %s does not exist", g.ModuleCode)
+	}
+	if g.InviteLink != nil && gs.DB.inviteLinkTaken(*g.InviteLink, "") {
+		return "", errors.New("Failed to add new group: invite link is taken by another group")
+	}
+
+	at := now()
+	joined := map[modwithfriends.ChatID]time.Time{}
+	for _, member := range g.Members {
+		if _, exist := gs.DB.users[member]; !exist {
+			return "", fmt.Errorf("Failed to add members of new group: user %d does not exist", member)
+		}
+		if _, exist := joined[member]; exist {
+			return "", fmt.Errorf("Failed to add members of new group: user %d is listed twice", member)
+		}
+		joined[member] = at
+	}
+
+	group := modwithfriends.Group{
+		ID:         uuid.New().String(),
+		ModuleCode: g.ModuleCode,
+		Model:      modwithfriends.Model{CreatedAt: at, UpdatedAt: at},
+	}
+	if g.InviteLink != nil {
+		inviteLink := *g.InviteLink
+		group.InviteLink = &inviteLink
+	}
+
+	gs.DB.groups[group.ID] = &group
+	gs.DB.memberships[group.ID] = joined
+
+	return group.ID, nil
+}
+
+func (gs *GroupService) UpdateGroup(groupID string, updatedGroup modwithfriends.Group) error {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	group, exist := gs.DB.groups[groupID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+	if updatedGroup.InviteLink != nil && gs.DB.inviteLinkTaken(*updatedGroup.InviteLink, groupID) {
+		return modwithfriends.ErrDuplicateEntityFound
+	}
+
+	at := now()
+	existing := gs.DB.memberships[groupID]
+	joined := map[modwithfriends.ChatID]time.Time{}
+	for _, member := range updatedGroup.Members {
+		if _, exist := gs.DB.users[member]; !exist {
+			return fmt.Errorf("Failed to add new members of group: user %d does not exist", member)
+		}
+
+		// Members who stay keep their place in the queue.
+		joined[member] = at
+		if joinedAt, exist := existing[member]; exist {
+			joined[member] = joinedAt
+		}
+	}
+
+	group.InviteLink = nil
+	if updatedGroup.InviteLink != nil {
+		inviteLink := *updatedGroup.InviteLink
+		group.InviteLink = &inviteLink
+	}
+	group.UpdatedAt = at
+	gs.DB.memberships[groupID] = joined
+
+	return nil
+}
+
+func (gs *GroupService) AssignInviteLinks(assignments []modwithfriends.InviteLinkAssignment) error {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	assigned := map[string]string{}
+	taken := map[string]bool{}
+	for _, assignment := range assignments {
+		group, exist := gs.DB.groups[assignment.GroupID]
+		if _, done := assigned[assignment.GroupID]; !exist || done || group.InviteLink != nil {
+			return modwithfriends.ErrEntityNotFound
+		}
+		if taken[assignment.InviteLink] || gs.DB.inviteLinkTaken(assignment.InviteLink, "") {
+			return modwithfriends.ErrDuplicateEntityFound
+		}
+
+		assigned[assignment.GroupID] = assignment.InviteLink
+		taken[assignment.InviteLink] = true
+	}
+
+	at := now()
+	for groupID, inviteLink := range assigned {
+		inviteLink := inviteLink
+		gs.DB.groups[groupID].InviteLink = &inviteLink
+		gs.DB.groups[groupID].UpdatedAt = at
+	}
+
+	return nil
+}
+
+func (gs *GroupService) MoveMember(fromGroupID string, toGroupID string, chatID modwithfriends.ChatID) error {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	from, exist := gs.DB.groups[fromGroupID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+	to, exist := gs.DB.groups[toGroupID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+	joinedAt, exist := gs.DB.memberships[fromGroupID][chatID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	at := now()
+	delete(gs.DB.memberships[fromGroupID], chatID)
+	gs.DB.memberships[toGroupID][chatID] = joinedAt
+	from.UpdatedAt = at
+	to.UpdatedAt = at
+
+	if len(gs.DB.memberships[fromGroupID]) == 0 {
+		gs.DB.deleteGroup(fromGroupID)
+	}
+
+	return nil
+}
+
+func (gs *GroupService) MergeGroups(fromGroupID string, intoGroupID string) error {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	if _, exist := gs.DB.groups[fromGroupID]; !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+	into, exist := gs.DB.groups[intoGroupID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	for chatID, joinedAt := range gs.DB.memberships[fromGroupID] {
+		gs.DB.memberships[intoGroupID][chatID] = joinedAt
+	}
+	into.UpdatedAt = now()
+	gs.DB.deleteGroup(fromGroupID)
+
+	return nil
+}
+
+func (gs *GroupService) DeleteGroup(groupID string) error {
+	gs.DB.mu.Lock()
+	defer gs.DB.mu.Unlock()
+
+	if _, exist := gs.DB.groups[groupID]; !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	gs.DB.deleteGroup(groupID)
+	return nil
+}
+
+// sortGroups orders groups by when they were created, for want of the order
+// Postgres happens to return them in.
+func sortGroups(groups []modwithfriends.Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		return compareGroups(groups[i], modwithfriends.NewGroupCursor(groups[j]), modwithfriends.SortByCreatedAt) < 0
+	})
+}
+
+func validState(state modwithfriends.GroupState) bool {
+	switch state {
+	case modwithfriends.GroupStateForming, modwithfriends.GroupStateFull, modwithfriends.GroupStateInvited:
+		return true
+	default:
+		return false
+	}
+}
+
+func inState(group modwithfriends.Group, state modwithfriends.GroupState) bool {
+	switch state {
+	case modwithfriends.GroupStateForming:
+		return group.InviteLink == nil && len(group.Members) < modwithfriends.GroupSize
+	case modwithfriends.GroupStateFull:
+		return group.InviteLink == nil && len(group.Members) >= modwithfriends.GroupSize
+	default:
+		return group.InviteLink != nil
+	}
+}
+
+func matchesQuery(group modwithfriends.Group, query modwithfriends.GroupQuery) bool {
+	if query.ModuleCode != nil && group.ModuleCode != *query.ModuleCode {
+		return false
+	}
+
+	if mcq := query.MemberCriteriaQuery; mcq != nil {
+		size := len(group.Members)
+		matches := map[modwithfriends.NumericComparator]bool{
+			modwithfriends.LessThan:        size < mcq.Count,
+			modwithfriends.LessThanOrEqual: size <= mcq.Count,
+			modwithfriends.Equal:           size == mcq.Count,
+			modwithfriends.MoreThanOrEqual: size >= mcq.Count,
+			modwithfriends.MoreThan:        size > mcq.Count,
+		}
+		if !matches[mcq.Condition] {
+			return false
+		}
+	}
+
+	if len(query.States) > 0 {
+		inAny := false
+		for _, state := range query.States {
+			inAny = inAny || inState(group, state)
+		}
+		if !inAny {
+			return false
+		}
+	}
+
+	if query.After != nil {
+		comparison := compareGroups(group, *query.After, query.SortBy)
+		if (!query.Descending && comparison <= 0) || (query.Descending && comparison >= 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareGroups compares the group with the cursor by the sort key and then
+// by ID, as GroupsBy orders groups.
+func compareGroups(group modwithfriends.Group, cursor modwithfriends.GroupCursor, sortBy modwithfriends.GroupSortKey) int {
+	if sortBy == modwithfriends.SortBySize {
+		if size := len(group.Members); size != cursor.Size {
+			if size < cursor.Size {
+				return -1
+			}
+			return 1
+		}
+	} else if !group.CreatedAt.Equal(cursor.CreatedAt) {
+		if group.CreatedAt.Before(cursor.CreatedAt) {
+			return -1
+		}
+		return 1
+	}
+
+	switch {
+	case group.ID < cursor.ID:
+		return -1
+	case group.ID > cursor.ID:
+		return 1
+	default:
+		return 0
+	}
+}
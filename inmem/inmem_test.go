@@ -0,0 +1,17 @@
+package inmem
+
+import (
+	"modwithfriends/servicetest"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) servicetest.Services {
+		db := NewDB()
+		return servicetest.Services{
+			Users:   &UserService{DB: db},
+			Modules: &ModuleService{DB: db},
+			Groups:  &GroupService{DB: db},
+		}
+	})
+}
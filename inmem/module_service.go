@@ -0,0 +1,62 @@
+package inmem
+
+import (
+	"modwithfriends"
+	"sort"
+)
+
+type ModuleService struct {
+	DB *DB
+}
+
+func (ms *ModuleService) Modules() ([]modwithfriends.ModuleCode, error) {
+	ms.DB.mu.Lock()
+	defer ms.DB.mu.Unlock()
+
+	modules := []modwithfriends.ModuleCode{}
+	for code := range ms.DB.modules {
+		modules = append(modules, code)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i] < modules[j] })
+
+	return modules, nil
+}
+
+func (ms *ModuleService) Exist(code modwithfriends.ModuleCode) (bool, error) {
+	ms.DB.mu.Lock()
+	defer ms.DB.mu.Unlock()
+
+	_, exist := ms.DB.modules[code]
+	return exist, nil
+}
+
+func (ms *ModuleService) CreateModule(code modwithfriends.ModuleCode) error {
+	ms.DB.mu.Lock()
+	defer ms.DB.mu.Unlock()
+
+	if _, exist := ms.DB.modules[code]; exist {
+		return modwithfriends.ErrDuplicateEntityFound
+	}
+
+	at := now()
+	ms.DB.modules[code] = modwithfriends.Model{CreatedAt: at, UpdatedAt: at}
+	return nil
+}
+
+func (ms *ModuleService) DeleteModule(code modwithfriends.ModuleCode) error {
+	ms.DB.mu.Lock()
+	defer ms.DB.mu.Unlock()
+
+	if _, exist := ms.DB.modules[code]; !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	for _, group := range ms.DB.groups {
+		if group.ModuleCode == code {
+			return modwithfriends.ErrEntityInUse
+		}
+	}
+
+	delete(ms.DB.modules, code)
+	return nil
+}
@@ -0,0 +1,175 @@
+package inmem
+
+import (
+	"modwithfriends"
+	"sort"
+)
+
+type UserService struct {
+	DB *DB
+}
+
+func (us *UserService) Users() ([]modwithfriends.ChatID, error) {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	users := []modwithfriends.ChatID{}
+	for chatID, user := range us.DB.users {
+		if user.active {
+			users = append(users, chatID)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+
+	return users, nil
+}
+
+func (us *UserService) Exist(chatID modwithfriends.ChatID) (bool, error) {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	_, exist := us.DB.users[chatID]
+	return exist, nil
+}
+
+func (us *UserService) CreateUser(chatID modwithfriends.ChatID) error {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	if _, exist := us.DB.users[chatID]; exist {
+		return modwithfriends.ErrDuplicateEntityFound
+	}
+
+	at := now()
+	us.DB.users[chatID] = &user{active: true, Model: modwithfriends.Model{CreatedAt: at, UpdatedAt: at}}
+	return nil
+}
+
+func (us *UserService) Groups(chatID modwithfriends.ChatID) ([]modwithfriends.Group, error) {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	groups := []modwithfriends.Group{}
+	for groupID, joined := range us.DB.memberships {
+		if _, member := joined[chatID]; member {
+			groups = append(groups, us.DB.group(groupID))
+		}
+	}
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func (us *UserService) Email(chatID modwithfriends.ChatID) (*string, error) {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	user, exist := us.DB.users[chatID]
+	if !exist {
+		return nil, modwithfriends.ErrEntityNotFound
+	}
+	if user.email == nil {
+		return nil, nil
+	}
+
+	email := *user.email
+	return &email, nil
+}
+
+func (us *UserService) Emails(chatIDs []modwithfriends.ChatID) (map[modwithfriends.ChatID]string, error) {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	emails := map[modwithfriends.ChatID]string{}
+	for _, chatID := range chatIDs {
+		if user, exist := us.DB.users[chatID]; exist && user.email != nil {
+			emails[chatID] = *user.email
+		}
+	}
+
+	return emails, nil
+}
+
+func (us *UserService) UpdateEmail(chatID modwithfriends.ChatID, email *string) error {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	user, exist := us.DB.users[chatID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	user.email = nil
+	if email != nil {
+		e := *email
+		user.email = &e
+	}
+	user.UpdatedAt = now()
+
+	return nil
+}
+
+func (us *UserService) ActivateUser(chatID modwithfriends.ChatID) error {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	if user, exist := us.DB.users[chatID]; exist && !user.active {
+		user.active = true
+		user.UpdatedAt = now()
+	}
+	return nil
+}
+
+// DeactivateUser marks the user as inactive and takes them out of every group
+// that has yet to be issued an invite link. The seat each of those groups
+// loses is backfilled with a member of a smaller forming group of the same
+// module, if there is one.
+func (us *UserService) DeactivateUser(chatID modwithfriends.ChatID) error {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	user, exist := us.DB.users[chatID]
+	if !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	at := now()
+	user.active = false
+	user.UpdatedAt = at
+
+	formingGroups := []string{}
+	for groupID, joined := range us.DB.memberships {
+		if _, member := joined[chatID]; member && us.DB.groups[groupID].InviteLink == nil {
+			formingGroups = append(formingGroups, groupID)
+		}
+	}
+	sort.Strings(formingGroups)
+
+	for _, groupID := range formingGroups {
+		// An earlier backfill may have moved the group's last member out and
+		// removed it.
+		if _, exist := us.DB.groups[groupID]; !exist {
+			continue
+		}
+		delete(us.DB.memberships[groupID], chatID)
+		us.DB.backfillGroup(groupID, at)
+	}
+
+	return nil
+}
+
+func (us *UserService) DeleteUser(chatID modwithfriends.ChatID) error {
+	us.DB.mu.Lock()
+	defer us.DB.mu.Unlock()
+
+	if _, exist := us.DB.users[chatID]; !exist {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	delete(us.DB.users, chatID)
+	for _, joined := range us.DB.memberships {
+		delete(joined, chatID)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package metrics holds the Prometheus metrics served at /metrics, so that
+// every package records them the same way.
+package metrics
+
+import (
+	"modwithfriends"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "modwithfriends"
+
+var (
+	// Commands counts the bot commands handled, by command.
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bot_commands_total",
+		Help:      "Bot commands handled, by command.",
+	}, []string{"command"})
+
+	// BroadcastMessages counts the messages of broadcasts and invite link
+	// notifications, by whether they were delivered or the code of the failure.
+	BroadcastMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broadcast_messages_total",
+		Help:      "Messages sent by broadcasts and notifications, by outcome.",
+	}, []string{"outcome"})
+
+	// DBQueryDuration times the statements sent to the database, by whether
+	// they are queries, execs or the start of a transaction.
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database statements, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// GroupEvents counts groups as they are created, filled, issued an invite
+	// link and dissolved.
+	GroupEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "group_events_total",
+		Help:      "Groups created, filled, issued an invite link and dissolved.",
+	}, []string{"event"})
+
+	// GroupFillDuration times how long groups take to fill up from when they
+	// were created.
+	GroupFillDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "group_fill_duration_seconds",
+		Help:      "Time taken by groups to fill up since they were created.",
+		Buckets:   prometheus.ExponentialBuckets(60, 4, 10),
+	})
+)
+
+const (
+	outcomeDelivered = "delivered"
+	outcomeUnknown   = "UNKNOWN"
+)
+
+// CountBroadcast records the outcome of a broadcast to the given number of
+// recipients.
+func CountBroadcast(recipients int, failures []modwithfriends.BroadcastFailure) {
+	BroadcastMessages.WithLabelValues(outcomeDelivered).Add(float64(recipients - len(failures)))
+
+	for _, failure := range failures {
+		code := failure.Code
+		if code == "" {
+			code = outcomeUnknown
+		}
+		BroadcastMessages.WithLabelValues(code).Inc()
+	}
+}
+
+// GroupPublisher counts group events. It should only be given the events of
+// changes made by this instance, so that each change is counted once.
+type GroupPublisher struct{}
+
+func (GroupPublisher) Publish(e modwithfriends.GroupEvent) {
+	wasFull := e.Previous != nil && len(e.Previous.Members) >= modwithfriends.GroupSize
+	isFull := len(e.Group.Members) >= modwithfriends.GroupSize
+
+	switch e.Type {
+	case modwithfriends.GroupCreated:
+		GroupEvents.WithLabelValues("created").Inc()
+	case modwithfriends.GroupDeleted:
+		GroupEvents.WithLabelValues("dissolved").Inc()
+		return
+	}
+
+	if isFull && !wasFull && e.Group.InviteLink == nil {
+		GroupEvents.WithLabelValues("filled").Inc()
+		GroupFillDuration.Observe(time.Since(e.Group.CreatedAt).Seconds())
+	}
+
+	if e.Group.InviteLink != nil && (e.Previous == nil || e.Previous.InviteLink == nil) {
+		GroupEvents.WithLabelValues("link_issued").Inc()
+	}
+}
@@ -1,16 +1,25 @@
 package modwithfriends
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 )
 
 var (
 	ErrEntityNotFound       = errors.New("Entity does not exist")
 	ErrDuplicateEntityFound = errors.New("Entity already exist")
+	ErrEntityInUse          = errors.New("Entity is still in use")
 )
 
+// GroupSize is the number of members a group needs before it is issued an
+// invite link.
+const GroupSize = 5
+
 type ChatID int
 type ModuleCode string
 
@@ -61,16 +70,65 @@ func (mcq MemberCriteriaQuery) String() (string, error) {
 	}
 }
 
+var NumericComparators = []NumericComparator{LessThan, LessThanOrEqual, Equal, MoreThanOrEqual, MoreThan}
+
+type GroupState string
+
+var (
+	// GroupStateForming is a group without an invite link that still has seats.
+	GroupStateForming = GroupState("FORMING")
+	// GroupStateFull is a group without an invite link that has no seats left.
+	GroupStateFull = GroupState("FULL")
+	// GroupStateInvited is a group that has been issued an invite link.
+	GroupStateInvited = GroupState("INVITED")
+)
+
+type GroupSortKey string
+
+var (
+	SortByCreatedAt = GroupSortKey("CREATED_AT")
+	SortBySize      = GroupSortKey("SIZE")
+)
+
+// GroupCursor points to the last group of a page, the next page starts after it.
+type GroupCursor struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int       `json:"size"`
+}
+
+func NewGroupCursor(g Group) GroupCursor {
+	return GroupCursor{
+		ID:        g.ID,
+		CreatedAt: g.CreatedAt,
+		Size:      len(g.Members),
+	}
+}
+
 type GroupQuery struct {
 	*ModuleCode
 	*MemberCriteriaQuery
-	Invited bool
+	// States matches groups in any of the given states, or in any state if empty.
+	States     []GroupState
+	SortBy     GroupSortKey
+	Descending bool
+	After      *GroupCursor
+	// Limit caps the number of groups returned, there is no cap if it is zero.
+	Limit int
 }
 
 type UserService interface {
 	Users() ([]ChatID, error)
+	Exist(chatID ChatID) (bool, error)
 	CreateUser(chatID ChatID) error
 	Groups(chatID ChatID) ([]Group, error)
+	Email(chatID ChatID) (*string, error)
+	// Emails looks up the emails of many users at once, leaving out users
+	// that do not exist or have no email.
+	Emails(chatIDs []ChatID) (map[ChatID]string, error)
+	UpdateEmail(chatID ChatID, email *string) error
+	ActivateUser(chatID ChatID) error
+	DeactivateUser(chatID ChatID) error
 	DeleteUser(chatID ChatID) error
 }
 
@@ -81,19 +139,291 @@ type ModuleService interface {
 	DeleteModule(code ModuleCode) error
 }
 
+// InviteLinkAssignment issues a group its invite link.
+type InviteLinkAssignment struct {
+	GroupID    string
+	InviteLink string
+}
+
 type GroupService interface {
 	Groups() ([]Group, error)
 	Group(groupID string) (Group, error)
 	GroupsBy(query GroupQuery) ([]Group, error)
 	CreateGroup(g Group) (string, error)
+	// UpdateGroup fails with ErrDuplicateEntityFound if the group's invite
+	// link is taken by another group.
 	UpdateGroup(groupID string, updatedGroup Group) error
+	// AssignInviteLinks applies every assignment or none of them. It fails with
+	// ErrEntityNotFound if a group does not exist or already has an invite
+	// link, and with ErrDuplicateEntityFound if a link is taken.
+	AssignInviteLinks(assignments []InviteLinkAssignment) error
+	// MoveMember moves a member from one group into another in one go, keeping
+	// when they joined, and removes the group they left if it is left empty.
+	// It fails with ErrEntityNotFound if either group does not exist or the
+	// user is not a member of the group they are moved from.
+	MoveMember(fromGroupID string, toGroupID string, chatID ChatID) error
+	// MergeGroups moves every member of a group into another in one go,
+	// keeping when they joined, and removes the group they left. It fails with
+	// ErrEntityNotFound if either group does not exist.
+	MergeGroups(fromGroupID string, intoGroupID string) error
 	DeleteGroup(groupID string) error
 }
 
+type GroupEventType string
+
+var (
+	GroupCreated = GroupEventType("group.created")
+	GroupUpdated = GroupEventType("group.updated")
+	GroupDeleted = GroupEventType("group.deleted")
+)
+
+// GroupEvent is a change to a group. Group is the group as it is after the
+// change, or as it was before it was deleted. Previous is the group as it was
+// before an update.
+type GroupEvent struct {
+	Type     GroupEventType `json:"type"`
+	Group    Group          `json:"group"`
+	Previous *Group         `json:"previous,omitempty"`
+}
+
+type GroupEventPublisher interface {
+	Publish(e GroupEvent)
+}
+
+// GroupEventSubscriber hands out a channel of group events along with a
+// function to stop receiving them.
+type GroupEventSubscriber interface {
+	Subscribe() (<-chan GroupEvent, func())
+}
+
+// Admin can sign in to the dashboard. Only a bcrypt hash of their password is
+// kept.
+type Admin struct {
+	ID           string `json:"adminId" db:"id"`
+	Username     string `json:"username" db:"username"`
+	PasswordHash string `json:"-" db:"password_hash"`
+	Model
+}
+
+// AdminSession is a signed in admin, identified by a hash of the token in
+// their session cookie.
+type AdminSession struct {
+	TokenHash string    `db:"token_hash"`
+	AdminID   string    `db:"admin_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+	Model
+}
+
+// IdempotencyRecord is the response saved for an Idempotency-Key, so that a
+// retried request is answered with it instead of being carried out again.
+// Keys are scoped to the API key that used them, APIKeyID being empty for the
+// shared password.
+type IdempotencyRecord struct {
+	APIKeyID    string `db:"api_key_id"`
+	Key         string `db:"key"`
+	RequestHash string `db:"request_hash"`
+	// StatusCode is nil while the first request is still in progress.
+	StatusCode *int      `db:"status_code"`
+	Body       []byte    `db:"body"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type IdempotencyService interface {
+	// Reserve takes the API key's key for a request and returns true, or
+	// returns what has been saved for it if it is already taken.
+	Reserve(apiKeyID string, key string, requestHash string) (IdempotencyRecord, bool, error)
+	Complete(apiKeyID string, key string, statusCode int, body []byte) error
+	// Release frees the key so that the request can be retried.
+	Release(apiKeyID string, key string) error
+}
+
+// AuditAction names an administrative action, prefixed by the type of entity
+// it acts on.
+type AuditAction string
+
+var (
+	AuditGroupCreate       = AuditAction("group.create")
+	AuditGroupUpdate       = AuditAction("group.update")
+	AuditGroupDelete       = AuditAction("group.delete")
+	AuditGroupInviteLink   = AuditAction("group.invite_link")
+	AuditGroupMerge        = AuditAction("group.merge")
+	AuditGroupAddMember    = AuditAction("group.add_member")
+	AuditGroupRemoveMember = AuditAction("group.remove_member")
+	AuditGroupMoveMember   = AuditAction("group.move_member")
+	AuditBroadcastSend     = AuditAction("broadcast.send")
+	AuditBroadcastRetry    = AuditAction("broadcast.retry")
+	AuditUserCreate        = AuditAction("user.create")
+	AuditUserUpdate        = AuditAction("user.update")
+	AuditUserDelete        = AuditAction("user.delete")
+	AuditModuleCreate      = AuditAction("module.create")
+	AuditModuleDelete      = AuditAction("module.delete")
+	AuditAPIKeyIssue       = AuditAction("api_key.issue")
+	AuditAPIKeyRotate      = AuditAction("api_key.rotate")
+	AuditAPIKeyRevoke      = AuditAction("api_key.revoke")
+	AuditWebhookCreate     = AuditAction("webhook.create")
+	AuditWebhookDelete     = AuditAction("webhook.delete")
+)
+
+// EntityType is the type of entity the action is taken on, e.g. group.
+func (a AuditAction) EntityType() string {
+	return strings.SplitN(string(a), ".", 2)[0]
+}
+
+// AuditEntry records an administrative action along with what the entity
+// looked like before and after it. Before is empty for entities that are
+// created, After for entities that are deleted.
+type AuditEntry struct {
+	ID string `json:"auditId" db:"id"`
+	// Actor is who took the action, e.g. api_key:<id> or admin:<username>.
+	Actor      string          `json:"actor" db:"actor"`
+	Action     AuditAction     `json:"action" db:"action"`
+	EntityType string          `json:"entityType" db:"entity_type"`
+	EntityID   string          `json:"entityId" db:"entity_id"`
+	Before     json.RawMessage `json:"before" db:"before"`
+	After      json.RawMessage `json:"after" db:"after"`
+	CreatedAt  time.Time       `json:"createdAt" db:"created_at"`
+}
+
+// AuditQuery filters the audit log, newest entries first. Entries are only
+// filtered by the fields that are set.
+type AuditQuery struct {
+	Actor      *string
+	Action     *AuditAction
+	EntityType *string
+	EntityID   *string
+	// Before is the ID of the last entry of the previous page.
+	Before *string
+	Limit  int
+}
+
+type AuditService interface {
+	Record(e AuditEntry) error
+	Entries(q AuditQuery) ([]AuditEntry, error)
+}
+
+type AdminService interface {
+	Admin(adminID string) (Admin, error)
+	AdminByUsername(username string) (Admin, error)
+	CreateAdmin(a Admin) (string, error)
+	UpdateAdmin(adminID string, updatedAdmin Admin) error
+	// Session returns the session unless it has expired.
+	Session(tokenHash string) (AdminSession, error)
+	CreateSession(s AdminSession) error
+	DeleteSession(tokenHash string) error
+}
+
+type WebhookEvent string
+
+var (
+	WebhookGroupCreated    = WebhookEvent("group.created")
+	WebhookGroupFull       = WebhookEvent("group.full")
+	WebhookGroupLinkIssued = WebhookEvent("group.link_issued")
+	WebhookUserLeft        = WebhookEvent("user.left")
+	// WebhookPing is only ever sent to test a webhook.
+	WebhookPing = WebhookEvent("ping")
+)
+
+var WebhookEvents = []WebhookEvent{
+	WebhookGroupCreated,
+	WebhookGroupFull,
+	WebhookGroupLinkIssued,
+	WebhookUserLeft,
+}
+
+// Webhook is a URL that is sent the events it is subscribed to, signed with
+// its secret.
+type Webhook struct {
+	ID     string         `json:"webhookId" db:"id"`
+	URL    string         `json:"url" db:"url"`
+	Secret string         `json:"-" db:"secret"`
+	Events []WebhookEvent `json:"events" db:"-"`
+	Model
+}
+
+func (w Webhook) Subscribed(event WebhookEvent) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event on its way to a webhook. It is due for another
+// attempt at NextAttemptAt until it is either delivered or given up on.
+type WebhookDelivery struct {
+	ID            string          `json:"deliveryId" db:"id"`
+	WebhookID     string          `json:"webhookId" db:"webhook_id"`
+	Event         WebhookEvent    `json:"event" db:"event"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	StatusCode    *int            `json:"statusCode" db:"status_code"`
+	Error         *string         `json:"error" db:"error"`
+	NextAttemptAt *time.Time      `json:"nextAttemptAt" db:"next_attempt_at"`
+	DeliveredAt   *time.Time      `json:"deliveredAt" db:"delivered_at"`
+	FailedAt      *time.Time      `json:"failedAt" db:"failed_at"`
+	Model
+}
+
+type WebhookService interface {
+	Webhooks() ([]Webhook, error)
+	Webhook(webhookID string) (Webhook, error)
+	CreateWebhook(w Webhook) (string, error)
+	DeleteWebhook(webhookID string) error
+	// CreateDeliveries queues the payload for every webhook subscribed to the event.
+	CreateDeliveries(event WebhookEvent, payload []byte) error
+	Deliveries(webhookID string, limit int) ([]WebhookDelivery, error)
+	// ClaimDeliveries returns deliveries that are due, holding them back from
+	// other claims for the lease so they are only attempted once at a time.
+	ClaimDeliveries(limit int, lease time.Duration) ([]WebhookDelivery, error)
+	UpdateDelivery(deliveryID string, updatedDelivery WebhookDelivery) error
+}
+
+// ModuleDemand is how many users have joined the groups of a module, and how
+// many of them are still waiting on an invite link.
+type ModuleDemand struct {
+	ModuleCode ModuleCode `json:"moduleCode" db:"module_id"`
+	Users      int        `json:"users" db:"users"`
+	Waiting    int        `json:"waiting" db:"waiting"`
+	Groups     int        `json:"groups" db:"group_count"`
+}
+
+// TrendingModule is a module by the number of users who joined its groups
+// recently.
+type TrendingModule struct {
+	ModuleCode ModuleCode `json:"moduleCode" db:"module_id"`
+	Joins      int        `json:"joins" db:"joins"`
+}
+
+// Stats are anonymous figures about groups that are safe to make public.
+type Stats struct {
+	Demand          []ModuleDemand `json:"demand"`
+	GroupsCompleted int            `json:"groupsCompleted"`
+	// MedianTimeToFill is in seconds, it is nil until a group has filled up.
+	MedianTimeToFill *float64         `json:"medianTimeToFillSeconds"`
+	Trending         []TrendingModule `json:"trending"`
+}
+
+type StatsService interface {
+	Stats(trendingSince time.Time, trendingLimit int) (Stats, error)
+}
+
 type BroadcastFailure struct {
-	User         ChatID `json:"user"`
-	Reason       error  `json:"-"`
-	ReasonString string `json:"reason"`
+	User         ChatID `json:"user" db:"user_id"`
+	Reason       error  `json:"-" db:"-"`
+	ReasonString string `json:"reason" db:"reason"`
+	Code         string `json:"code" db:"code"`
+}
+
+// Broadcast records a message sent to many users along with the users it
+// failed to reach. Subject is set for notifications, which are delivered
+// through a Notifier rather than broadcasted over Telegram alone.
+type Broadcast struct {
+	ID       string             `json:"broadcastId" db:"id"`
+	Subject  *string            `json:"subject" db:"subject"`
+	Message  string             `json:"message" db:"message"`
+	Failures []BroadcastFailure `json:"failures"`
+	Model
 }
 
 type BroadcastRate struct {
@@ -101,11 +431,118 @@ type BroadcastRate struct {
 	Delay time.Duration
 }
 
+type Scope string
+
+var (
+	ScopeGroupsRead    = Scope("groups:read")
+	ScopeGroupsWrite   = Scope("groups:write")
+	ScopeBroadcast     = Scope("broadcast")
+	ScopeUsersRead     = Scope("users:read")
+	ScopeUsersWrite    = Scope("users:write")
+	ScopeModulesRead   = Scope("modules:read")
+	ScopeModulesWrite  = Scope("modules:write")
+	ScopeKeysAdmin     = Scope("keys:admin")
+	ScopeWebhooksAdmin = Scope("webhooks:admin")
+	ScopeAuditRead     = Scope("audit:read")
+	ScopeMetricsRead   = Scope("metrics:read")
+)
+
+var AllScopes = []Scope{
+	ScopeGroupsRead,
+	ScopeGroupsWrite,
+	ScopeBroadcast,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeModulesRead,
+	ScopeModulesWrite,
+	ScopeKeysAdmin,
+	ScopeWebhooksAdmin,
+	ScopeAuditRead,
+	ScopeMetricsRead,
+}
+
+// APIKey grants access to the protected HTTP APIs within its scopes. Only a
+// hash of the key is kept, the prefix is there to tell keys apart.
+type APIKey struct {
+	ID        string     `json:"keyId" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	Prefix    string     `json:"prefix" db:"prefix"`
+	Hash      string     `json:"-" db:"key_hash"`
+	Scopes    []Scope    `json:"scopes" db:"-"`
+	ExpiresAt *time.Time `json:"expiresAt" db:"expires_at"`
+	RevokedAt *time.Time `json:"revokedAt" db:"revoked_at"`
+	Model
+}
+
+func (k APIKey) Valid(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+func (k APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKeyService interface {
+	APIKeys() ([]APIKey, error)
+	APIKey(keyID string) (APIKey, error)
+	APIKeyByHash(hash string) (APIKey, error)
+	CreateAPIKey(k APIKey) (string, error)
+	UpdateAPIKey(keyID string, updatedKey APIKey) error
+}
+
+type BroadcastService interface {
+	Broadcast(broadcastID string) (Broadcast, error)
+	CreateBroadcast(b Broadcast) (string, error)
+	UpdateFailures(broadcastID string, failures []BroadcastFailure) error
+}
+
+// Database is checked by the health checks to tell whether it can be reached.
+type Database interface {
+	PingContext(ctx context.Context) error
+}
+
+// Profile is what Telegram shows of a user.
+type Profile struct {
+	FirstName string
+	LastName  string
+	Username  string
+}
+
 type Bot interface {
 	Start()
+	// LastPoll is when updates were last fetched from Telegram, or the zero
+	// time if they have yet to be.
+	LastPoll() time.Time
+	Profile(chatID ChatID) (Profile, error)
 	Broadcast(chatIDs []ChatID, msg string, opts *BroadcastRate) []BroadcastFailure
+	BroadcastTemplate(chatIDs []ChatID, tmpl *MessageTemplate, opts *BroadcastRate) []BroadcastFailure
+}
+
+// TelegramWebhook receives the updates Telegram pushes to the bot in webhook
+// mode.
+type TelegramWebhook interface {
+	http.Handler
+	// Path is where Telegram pushes the updates to.
+	Path() string
 }
 
 type EmailService interface {
 	Send(subject string, recipients []string, message string) error
 }
+
+type Notification struct {
+	Subject string
+	Message string
+}
+
+type Notifier interface {
+	Notify(chatID ChatID, n Notification) error
+}
@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"modwithfriends"
+)
+
+var (
+	ErrNoEmail = errors.New("User has not registered an email")
+)
+
+// Email notifies users at the email address they registered with the bot.
+type Email struct {
+	EmailService modwithfriends.EmailService
+	UserService  modwithfriends.UserService
+}
+
+func (e *Email) Notify(chatID modwithfriends.ChatID, n modwithfriends.Notification) error {
+	email, err := e.UserService.Email(chatID)
+	if err != nil {
+		return fmt.Errorf("Failed to get user's email for notification: %w", err)
+	}
+	if email == nil {
+		return ErrNoEmail
+	}
+
+	err = e.EmailService.Send(n.Subject, []string{*email}, n.Message)
+	if err != nil {
+		return fmt.Errorf("Failed to email notification to user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"modwithfriends"
+	"strings"
+)
+
+// FallbackError holds the error of every channel that failed to deliver a
+// notification. It unwraps to the error of the first channel.
+type FallbackError struct {
+	Errors []error
+}
+
+func (fe *FallbackError) Error() string {
+	reasons := make([]string, 0, len(fe.Errors))
+	for _, err := range fe.Errors {
+		reasons = append(reasons, err.Error())
+	}
+	return "Failed to deliver notification through any channel: " + strings.Join(reasons, "; ")
+}
+
+func (fe *FallbackError) Unwrap() error {
+	if len(fe.Errors) == 0 {
+		return nil
+	}
+	return fe.Errors[0]
+}
+
+type fallback struct {
+	notifiers []modwithfriends.Notifier
+}
+
+// Fallback returns a Notifier that tries each notifier in order until one of
+// them delivers the notification.
+func Fallback(notifiers ...modwithfriends.Notifier) modwithfriends.Notifier {
+	return &fallback{notifiers}
+}
+
+func (f *fallback) Notify(chatID modwithfriends.ChatID, n modwithfriends.Notification) error {
+	errs := []error{}
+
+	for _, notifier := range f.notifiers {
+		err := notifier.Notify(chatID, n)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	return &FallbackError{errs}
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"modwithfriends/sqlstore"
+
+	"github.com/lib/pq"
+)
+
+// Dialect is Postgres' SQL, for the sqlstore services.
+type Dialect struct{}
+
+var _ sqlstore.Dialect = Dialect{}
+
+func (Dialect) GroupMembersColumn() string {
+	return `string_agg(m.user_id::text, ',' ORDER BY m.created_at, m.user_id) AS member_ids`
+}
+
+func (Dialect) UUID() string {
+	return `uuid_generate_v4()`
+}
+
+func (Dialect) JSON(placeholder string) string {
+	return placeholder + `::jsonb`
+}
+
+// List keeps lists in text arrays.
+func (Dialect) List(list []string) interface{} {
+	return pq.StringArray(list)
+}
+
+func (Dialect) ScanList(src interface{}) ([]string, error) {
+	list := pq.StringArray{}
+	if err := list.Scan(src); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (Dialect) ListContains(column string, placeholder string) string {
+	return placeholder + `::text=ANY(` + column + `)`
+}
+
+func (Dialect) SkipLocked() string {
+	return `FOR UPDATE SKIP LOCKED`
+}
+
+func (Dialect) IsDuplicate(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+func (Dialect) IsForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23503"
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"modwithfriends"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const groupEventsChannel = "group_events"
+
+// EventBridge publishes group events with NOTIFY so that every instance
+// listening with ListenGroupEvents receives them, this one included.
+type EventBridge struct {
+	DB *sqlx.DB
+}
+
+func (eb *EventBridge) Publish(e modwithfriends.GroupEvent) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode %s event for group %s: %s", e.Type, e.Group.ID, err)
+		return
+	}
+
+	const query = `SELECT pg_notify($1, $2)`
+	_, err = eb.DB.Exec(query, groupEventsChannel, string(payload))
+	if err != nil {
+		log.Printf("Failed to notify %s event for group %s: %s", e.Type, e.Group.ID, err)
+	}
+}
+
+// ListenGroupEvents passes on the group events notified by every instance to
+// the publisher. The listener reconnects by itself, events notified while it
+// is disconnected are lost.
+func ListenGroupEvents(connectionString string, publisher modwithfriends.GroupEventPublisher) (*pq.Listener, error) {
+	listener := pq.NewListener(connectionString, 1*time.Second, 1*time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Group events listener:", err)
+		}
+	})
+
+	err := listener.Listen(groupEventsChannel)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("Failed to listen for group events: %w", err)
+	}
+
+	go func() {
+		for notification := range listener.Notify {
+			// A nil notification means the connection was re-established.
+			if notification == nil {
+				continue
+			}
+
+			e := modwithfriends.GroupEvent{}
+			if err := json.Unmarshal([]byte(notification.Extra), &e); err != nil {
+				log.Println("Failed to decode group event:", err)
+				continue
+			}
+			publisher.Publish(e)
+		}
+	}()
+
+	return listener, nil
+}
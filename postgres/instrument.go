@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"modwithfriends/metrics"
+	"time"
+)
+
+// instrumentedConnector hands out connections that time every statement
+// sent to the database.
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (ic instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := ic.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return instrumentedConn{conn}, nil
+}
+
+// instrumentedConn wraps a pq connection, which supports contexts, and passes
+// on the rest of the driver interfaces it implements.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (ic instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observe("query", time.Now())
+	return ic.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (ic instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observe("exec", time.Now())
+	return ic.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (ic instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	defer observe("begin", time.Now())
+	return ic.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (ic instrumentedConn) Ping(ctx context.Context) error {
+	return ic.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func observe(operation string, start time.Time) {
+	metrics.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
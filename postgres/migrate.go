@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationLockID is the advisory lock held while migrating, so that
+// instances booting at the same time do not migrate at once.
+const migrationLockID = 7426550312
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+var migrationFileRx = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration changes the schema from the previous version to Version with Up,
+// and back with Down.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations are the migrations embedded in the binary, by version. Versions
+// start at 1 and leave no gaps.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileRx.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Failed to read migrations: %s is not named like 0001_name.up.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("Failed to read migrations: version %d is named both %s and %s", version, m.Name, match[2])
+		}
+
+		b, err := migrationFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read migration %s: %w", entry.Name(), err)
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("Failed to read migrations: version %d needs both an up and a down migration", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("Failed to read migrations: expected version %d but found %d", i+1, m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrate applies the migrations the database has yet to be, each in a
+// transaction of its own, and returns them.
+func Migrate(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	err = withMigrationLock(db, func(conn *sqlx.Conn, version int) error {
+		for _, m := range migrations[version:] {
+			err := runMigration(conn, m.Up, `INSERT INTO schema_migrations(version, name) VALUES($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("Failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Rollback reverts the last steps migrations that were applied and returns
+// them.
+func Rollback(db *sqlx.DB, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []Migration{}
+	err = withMigrationLock(db, func(conn *sqlx.Conn, version int) error {
+		if version > len(migrations) {
+			return fmt.Errorf("Failed to roll back: database is at version %d, which this binary does not know of", version)
+		}
+
+		for ; steps > 0 && version > 0; steps, version = steps-1, version-1 {
+			m := migrations[version-1]
+			err := runMigration(conn, m.Down, `DELETE FROM schema_migrations WHERE version=$1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("Failed to roll back migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// ForceVersion records the database as being at version without running any
+// migration, for databases that were set up by hand before there were
+// migrations.
+func ForceVersion(db *sqlx.DB, version int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if version < 0 || version > len(migrations) {
+		return fmt.Errorf("Failed to force version: there is no version %d", version)
+	}
+
+	return withMigrationLock(db, func(conn *sqlx.Conn, _ int) error {
+		tx, err := conn.BeginTxx(context.Background(), nil)
+		if err != nil {
+			return fmt.Errorf("Failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM schema_migrations`); err != nil {
+			return fmt.Errorf("Failed to clear schema migrations: %w", err)
+		}
+		for _, m := range migrations[:version] {
+			_, err := tx.Exec(`INSERT INTO schema_migrations(version, name) VALUES($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("Failed to record migration %d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("Failed to commit forced version: %w", err)
+		}
+		return nil
+	})
+}
+
+// SchemaVersion is the version of the last migration applied, 0 if there is
+// none.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	var version int
+	err := withMigrationLock(db, func(_ *sqlx.Conn, v int) error {
+		version = v
+		return nil
+	})
+	return version, err
+}
+
+// withMigrationLock runs f holding the migration lock on a connection of its
+// own, as advisory locks belong to the connection that took them.
+func withMigrationLock(db *sqlx.DB, f func(conn *sqlx.Conn, version int) error) error {
+	ctx := context.Background()
+
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get connection for migrating: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("Failed to take migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	var hasMigrations, hasUsers bool
+	const tablesQuery = `SELECT to_regclass('schema_migrations') IS NOT NULL, to_regclass('users') IS NOT NULL`
+	if err := conn.QueryRowxContext(ctx, tablesQuery).Scan(&hasMigrations, &hasUsers); err != nil {
+		return fmt.Errorf("Failed to query existing tables from database: %w", err)
+	}
+
+	if !hasMigrations {
+		if err := createMigrationsTable(conn, hasUsers); err != nil {
+			return err
+		}
+	}
+
+	var version int
+	err = conn.QueryRowxContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("Failed to query schema version from database: %w", err)
+	}
+
+	return f(conn, version)
+}
+
+// runMigration runs the migration's statements and records it in the same
+// transaction, so that a migration is either applied and recorded or not at
+// all.
+func runMigration(conn *sqlx.Conn, statements string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Statements are run without arguments so that a file can hold many.
+	if _, err := tx.Exec(statements); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return fmt.Errorf("Failed to record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// createMigrationsTable creates the table keeping the schema version. A
+// database set up from schema.sql before there were migrations already has
+// the tables of the first migration, so it is baselined at version 1 rather
+// than have them created again.
+func createMigrationsTable(conn *sqlx.Conn, baseline bool) error {
+	tx, err := conn.BeginTxx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const createQuery = `CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+	)`
+	if _, err := tx.Exec(createQuery); err != nil {
+		return fmt.Errorf("Failed to create schema migrations table: %w", err)
+	}
+
+	if baseline {
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		first := migrations[0]
+		_, err = tx.Exec(`INSERT INTO schema_migrations(version, name) VALUES($1, $2)`, first.Version, first.Name)
+		if err != nil {
+			return fmt.Errorf("Failed to baseline database at migration %d_%s: %w", first.Version, first.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit schema migrations table: %w", err)
+	}
+	return nil
+}
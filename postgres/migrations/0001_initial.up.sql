@@ -26,4 +26,4 @@ CREATE TABLE memberships (
     CONSTRAINT participations_pk PRIMARY KEY (user_id, group_id),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
-);
\ No newline at end of file
+);
@@ -0,0 +1,2 @@
+DROP TABLE broadcast_failures;
+DROP TABLE broadcasts;
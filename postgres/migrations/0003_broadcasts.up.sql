@@ -0,0 +1,17 @@
+CREATE TABLE broadcasts (
+    id UUID PRIMARY KEY,
+    subject TEXT,
+    message TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE TABLE broadcast_failures (
+    broadcast_id UUID REFERENCES broadcasts(id) ON UPDATE RESTRICT ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT broadcast_failures_pk PRIMARY KEY (broadcast_id, user_id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN deactivated_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1 @@
+ALTER TABLE broadcast_failures DROP COLUMN code;
@@ -0,0 +1 @@
+ALTER TABLE broadcast_failures ADD COLUMN code TEXT NOT NULL DEFAULT 'UNKNOWN';
@@ -0,0 +1,7 @@
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER,
+    body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
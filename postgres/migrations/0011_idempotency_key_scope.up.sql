@@ -0,0 +1,8 @@
+-- Keys are scoped to the API key that used them, so that clients cannot replay
+-- or block each other's requests. Keys saved so far belong to no API key and
+-- are dropped, they would have expired within a day anyway. The shared
+-- password has no API key ID and uses the empty string.
+DELETE FROM idempotency_keys;
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD COLUMN api_key_id TEXT NOT NULL;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (api_key_id, key);
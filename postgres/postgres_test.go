@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"modwithfriends/servicetest"
+	"modwithfriends/sqlstore"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const envTestDatabaseURL = "TEST_DATABASE_URL"
+
+// testDB opens the database at TEST_DATABASE_URL, migrated and emptied of
+// users, modules and groups, or skips the test if it is not set.
+func testDB(tb testing.TB) *sqlx.DB {
+	databaseURL := os.Getenv(envTestDatabaseURL)
+	if databaseURL == "" {
+		tb.Skipf("%s is not set", envTestDatabaseURL)
+	}
+
+	db, err := Open(databaseURL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if _, err := Migrate(db); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.Exec(`TRUNCATE users, modules, groups, memberships CASCADE`); err != nil {
+		tb.Fatal(err)
+	}
+
+	return db
+}
+
+func TestServices(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) servicetest.Services {
+		db := testDB(t)
+		return servicetest.Services{
+			Users:   &sqlstore.UserService{DB: db, Dialect: Dialect{}},
+			Modules: &sqlstore.ModuleService{DB: db, Dialect: Dialect{}},
+			Groups:  &sqlstore.GroupService{DB: db, Dialect: Dialect{}},
+		}
+	})
+}
+
+func TestMigrateBaselinesDatabaseWithoutMigrations(t *testing.T) {
+	db := testDB(t)
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Rollback(db, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DROP TABLE schema_migrations`); err != nil {
+		t.Fatal(err)
+	}
+	// The old schema.sql created the tables of the first migration.
+	if _, err := db.Exec(migrations[0].Up); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := Migrate(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations)-1 || applied[0].Version != 2 {
+		t.Errorf("Migrate applied %d migrations, want versions 2 to %d", len(applied), len(migrations))
+	}
+}
@@ -1,16 +1,24 @@
 package postgres
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 const dialect = "postgres"
 
 func Open(connectionString string) (*sqlx.DB, error) {
-	db, err := sqlx.Connect(dialect, connectionString)
+	connector, err := pq.NewConnector(connectionString)
 	if err != nil {
+		return nil, fmt.Errorf("Failed to parse database connection string: %w", err)
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(instrumentedConnector{connector}), dialect)
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("Failed to connect to database: %w", err)
 	}
 	return db, nil
@@ -0,0 +1,541 @@
+// Package servicetest is the contract the user, module and group services
+// keep, so that every package implementing them behaves the same. Each
+// package runs it from its own tests.
+package servicetest
+
+import (
+	"modwithfriends"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Services are the services under test, sharing whatever they keep their data
+// in.
+type Services struct {
+	Users   modwithfriends.UserService
+	Modules modwithfriends.ModuleService
+	Groups  modwithfriends.GroupService
+}
+
+// Run runs the contract against the services returned by newServices, which
+// must start out without any users, modules or groups.
+func Run(t *testing.T, newServices func(t *testing.T) Services) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Services)
+	}{
+		{"Users", testUsers},
+		{"Modules", testModules},
+		{"Groups", testGroups},
+		{"InviteLinks", testInviteLinks},
+		{"GroupsBy", testGroupsBy},
+		{"MoveMember", testMoveMember},
+		{"MergeGroups", testMergeGroups},
+		{"DeactivateUser", testDeactivateUser},
+		{"DeleteUser", testDeleteUser},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newServices(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, s Services) {
+	createUsers(t, s, 1, 2)
+
+	if err := s.Users.CreateUser(1); err != modwithfriends.ErrDuplicateEntityFound {
+		t.Errorf("CreateUser of existing user = %v, want %v", err, modwithfriends.ErrDuplicateEntityFound)
+	}
+
+	exist, err := s.Users.Exist(1)
+	if err != nil || !exist {
+		t.Errorf("Exist of existing user = %v, %v, want true", exist, err)
+	}
+	exist, err = s.Users.Exist(3)
+	if err != nil || exist {
+		t.Errorf("Exist of missing user = %v, %v, want false", exist, err)
+	}
+
+	email, err := s.Users.Email(1)
+	if err != nil || email != nil {
+		t.Errorf("Email of user without one = %v, %v, want nil", email, err)
+	}
+	want := "user@example.com"
+	if err := s.Users.UpdateEmail(1, &want); err != nil {
+		t.Fatalf("UpdateEmail = %v", err)
+	}
+	email, err = s.Users.Email(1)
+	if err != nil || email == nil || *email != want {
+		t.Errorf("Email after UpdateEmail = %v, %v, want %s", email, err, want)
+	}
+	emails, err := s.Users.Emails([]modwithfriends.ChatID{1, 2, 3})
+	if want := map[modwithfriends.ChatID]string{1: want}; err != nil || !reflect.DeepEqual(emails, want) {
+		t.Errorf("Emails = %v, %v, want %v", emails, err, want)
+	}
+	if _, err := s.Users.Email(3); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("Email of missing user = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	if err := s.Users.UpdateEmail(3, &want); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("UpdateEmail of missing user = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+
+	if err := s.Users.DeactivateUser(2); err != nil {
+		t.Fatalf("DeactivateUser = %v", err)
+	}
+	assertUsers(t, s, 1)
+	if err := s.Users.DeactivateUser(3); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("DeactivateUser of missing user = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+
+	if err := s.Users.ActivateUser(2); err != nil {
+		t.Fatalf("ActivateUser = %v", err)
+	}
+	assertUsers(t, s, 1, 2)
+	if err := s.Users.ActivateUser(3); err != nil {
+		t.Errorf("ActivateUser of missing user = %v, want nil", err)
+	}
+}
+
+func testModules(t *testing.T, s Services) {
+	createModules(t, s, "CS1010", "CS2030")
+	createUsers(t, s, 1)
+
+	if err := s.Modules.CreateModule("CS1010"); err != modwithfriends.ErrDuplicateEntityFound {
+		t.Errorf("CreateModule of existing module = %v, want %v", err, modwithfriends.ErrDuplicateEntityFound)
+	}
+
+	exist, err := s.Modules.Exist("CS1010")
+	if err != nil || !exist {
+		t.Errorf("Exist of existing module = %v, %v, want true", exist, err)
+	}
+	exist, err = s.Modules.Exist("CS3230")
+	if err != nil || exist {
+		t.Errorf("Exist of missing module = %v, %v, want false", exist, err)
+	}
+
+	createGroup(t, s, "CS1010", 1)
+	if err := s.Modules.DeleteModule("CS1010"); err != modwithfriends.ErrEntityInUse {
+		t.Errorf("DeleteModule of module with groups = %v, want %v", err, modwithfriends.ErrEntityInUse)
+	}
+	if err := s.Modules.DeleteModule("CS2030"); err != nil {
+		t.Errorf("DeleteModule = %v", err)
+	}
+	if err := s.Modules.DeleteModule("CS2030"); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("DeleteModule of missing module = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+
+	modules, err := s.Modules.Modules()
+	if err != nil || !reflect.DeepEqual(modules, []modwithfriends.ModuleCode{"CS1010"}) {
+		t.Errorf("Modules = %v, %v, want [CS1010]", modules, err)
+	}
+}
+
+func testGroups(t *testing.T, s Services) {
+	createModules(t, s, "CS1010")
+	createUsers(t, s, 1, 2, 3, 4)
+
+	if _, err := s.Groups.CreateGroup(modwithfriends.Group{ModuleCode: "CS3230"}); err == nil {
+		t.Error("CreateGroup of missing module succeeded")
+	}
+	if _, err := s.Groups.CreateGroup(modwithfriends.Group{ModuleCode: "CS1010", Members: []modwithfriends.ChatID{9}}); err == nil {
+		t.Error("CreateGroup with missing user succeeded")
+	}
+
+	groupID := createGroup(t, s, "CS1010", 1, 2)
+	group := assertMembers(t, s, groupID, 1, 2)
+	if group.ModuleCode != "CS1010" || group.InviteLink != nil || group.CreatedAt.IsZero() {
+		t.Errorf("Group = %+v, want a forming group of CS1010", group)
+	}
+	if _, err := s.Groups.Group("missing"); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("Group of missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+
+	// Members who stay keep their place, those who join go last.
+	wait()
+	err := s.Groups.UpdateGroup(groupID, modwithfriends.Group{Members: []modwithfriends.ChatID{3, 2}})
+	if err != nil {
+		t.Fatalf("UpdateGroup = %v", err)
+	}
+	assertMembers(t, s, groupID, 2, 3)
+
+	err = s.Groups.UpdateGroup("missing", modwithfriends.Group{Members: []modwithfriends.ChatID{4}})
+	if err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("UpdateGroup of missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	err = s.Groups.UpdateGroup("missing", modwithfriends.Group{})
+	if err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("UpdateGroup of missing group without members = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+
+	otherID := createGroup(t, s, "CS1010", 4)
+	groups, err := s.Groups.Groups()
+	if ids := sortedIDs(groupIDs(groups)...); err != nil || !reflect.DeepEqual(ids, sortedIDs(groupID, otherID)) {
+		t.Errorf("Groups = %v, %v, want %v", ids, err, sortedIDs(groupID, otherID))
+	}
+
+	userGroups, err := s.Users.Groups(4)
+	if err != nil || !reflect.DeepEqual(groupIDs(userGroups), []string{otherID}) {
+		t.Errorf("Users.Groups = %v, %v, want [%s]", groupIDs(userGroups), err, otherID)
+	}
+
+	if err := s.Groups.DeleteGroup(otherID); err != nil {
+		t.Fatalf("DeleteGroup = %v", err)
+	}
+	if err := s.Groups.DeleteGroup(otherID); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("DeleteGroup of missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	userGroups, err = s.Users.Groups(4)
+	if err != nil || len(userGroups) != 0 {
+		t.Errorf("Users.Groups after DeleteGroup = %v, %v, want none", groupIDs(userGroups), err)
+	}
+}
+
+func testInviteLinks(t *testing.T, s Services) {
+	createModules(t, s, "CS1010")
+	createUsers(t, s, 1, 2, 3)
+	first := createGroup(t, s, "CS1010", 1)
+	second := createGroup(t, s, "CS1010", 2)
+	third := createGroup(t, s, "CS1010", 3)
+
+	err := s.Groups.AssignInviteLinks([]modwithfriends.InviteLinkAssignment{{GroupID: first, InviteLink: "https://t.me/1"}})
+	if err != nil {
+		t.Fatalf("AssignInviteLinks = %v", err)
+	}
+	assertInviteLink(t, s, first, "https://t.me/1")
+
+	tests := []struct {
+		name        string
+		assignments []modwithfriends.InviteLinkAssignment
+		want        error
+	}{
+		{"LinkTaken", []modwithfriends.InviteLinkAssignment{
+			{GroupID: second, InviteLink: "https://t.me/2"},
+			{GroupID: third, InviteLink: "https://t.me/1"},
+		}, modwithfriends.ErrDuplicateEntityFound},
+		{"LinkTwice", []modwithfriends.InviteLinkAssignment{
+			{GroupID: second, InviteLink: "https://t.me/2"},
+			{GroupID: third, InviteLink: "https://t.me/2"},
+		}, modwithfriends.ErrDuplicateEntityFound},
+		{"GroupInvited", []modwithfriends.InviteLinkAssignment{
+			{GroupID: second, InviteLink: "https://t.me/2"},
+			{GroupID: first, InviteLink: "https://t.me/3"},
+		}, modwithfriends.ErrEntityNotFound},
+		{"GroupMissing", []modwithfriends.InviteLinkAssignment{
+			{GroupID: second, InviteLink: "https://t.me/2"},
+			{GroupID: "missing", InviteLink: "https://t.me/3"},
+		}, modwithfriends.ErrEntityNotFound},
+	}
+
+	for _, tt := range tests {
+		if err := s.Groups.AssignInviteLinks(tt.assignments); err != tt.want {
+			t.Errorf("%s: AssignInviteLinks = %v, want %v", tt.name, err, tt.want)
+		}
+		// None of the assignments apply when one of them fails.
+		assertInviteLink(t, s, second, "")
+	}
+
+	group, err := s.Groups.Group(second)
+	if err != nil {
+		t.Fatalf("Group = %v", err)
+	}
+	taken := "https://t.me/1"
+	group.InviteLink = &taken
+	if err := s.Groups.UpdateGroup(second, group); err != modwithfriends.ErrDuplicateEntityFound {
+		t.Errorf("UpdateGroup with taken link = %v, want %v", err, modwithfriends.ErrDuplicateEntityFound)
+	}
+	assertInviteLink(t, s, second, "")
+}
+
+func testGroupsBy(t *testing.T, s Services) {
+	createModules(t, s, "CS1010", "CS2030")
+	createUsers(t, s, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+
+	small := createGroup(t, s, "CS1010", 1)
+	full := createGroup(t, s, "CS1010", 2, 3, 4, 5, 6)
+	invited := createGroup(t, s, "CS1010", 7, 8)
+	other := createGroup(t, s, "CS2030", 9)
+	err := s.Groups.AssignInviteLinks([]modwithfriends.InviteLinkAssignment{{GroupID: invited, InviteLink: "https://t.me/1"}})
+	if err != nil {
+		t.Fatalf("AssignInviteLinks = %v", err)
+	}
+
+	module := modwithfriends.ModuleCode("CS1010")
+	tests := []struct {
+		name  string
+		query modwithfriends.GroupQuery
+		want  []string
+	}{
+		{"All", modwithfriends.GroupQuery{}, []string{small, full, invited, other}},
+		{"Module", modwithfriends.GroupQuery{ModuleCode: &module}, []string{small, full, invited}},
+		{"MemberCriteria", modwithfriends.GroupQuery{
+			MemberCriteriaQuery: &modwithfriends.MemberCriteriaQuery{Condition: modwithfriends.LessThanOrEqual, Count: 2},
+		}, []string{small, invited, other}},
+		{"States", modwithfriends.GroupQuery{
+			States: []modwithfriends.GroupState{modwithfriends.GroupStateFull, modwithfriends.GroupStateInvited},
+		}, []string{full, invited}},
+		{"Descending", modwithfriends.GroupQuery{Descending: true}, []string{other, invited, full, small}},
+		{"Size", modwithfriends.GroupQuery{SortBy: modwithfriends.SortBySize, ModuleCode: &module}, []string{small, invited, full}},
+		{"Limit", modwithfriends.GroupQuery{Limit: 2}, []string{small, full}},
+	}
+
+	for _, tt := range tests {
+		groups, err := s.Groups.GroupsBy(tt.query)
+		if err != nil || !reflect.DeepEqual(groupIDs(groups), tt.want) {
+			t.Errorf("%s: GroupsBy = %v, %v, want %v", tt.name, groupIDs(groups), err, tt.want)
+		}
+	}
+
+	// Paging through the groups two at a time finds each of them once.
+	for _, sortBy := range []modwithfriends.GroupSortKey{modwithfriends.SortByCreatedAt, modwithfriends.SortBySize} {
+		seen := []string{}
+		query := modwithfriends.GroupQuery{SortBy: sortBy, Limit: 2}
+		for page := 0; page < 4; page++ {
+			groups, err := s.Groups.GroupsBy(query)
+			if err != nil {
+				t.Fatalf("GroupsBy = %v", err)
+			}
+			if len(groups) == 0 {
+				break
+			}
+			seen = append(seen, groupIDs(groups)...)
+			cursor := modwithfriends.NewGroupCursor(groups[len(groups)-1])
+			query.After = &cursor
+		}
+		sort.Strings(seen)
+		if want := sortedIDs(small, full, invited, other); !reflect.DeepEqual(seen, want) {
+			t.Errorf("paging by %s = %v, want %v", sortBy, seen, want)
+		}
+	}
+
+	invalid := []modwithfriends.GroupQuery{
+		{SortBy: "name"},
+		{States: []modwithfriends.GroupState{"DONE"}},
+		{MemberCriteriaQuery: &modwithfriends.MemberCriteriaQuery{Condition: "ABOUT", Count: 1}},
+	}
+	for _, query := range invalid {
+		if _, err := s.Groups.GroupsBy(query); err == nil {
+			t.Errorf("GroupsBy(%+v) succeeded", query)
+		}
+	}
+}
+
+func testMoveMember(t *testing.T, s Services) {
+	createModules(t, s, "CS1010")
+	createUsers(t, s, 1, 2, 3, 4)
+	from := createGroup(t, s, "CS1010", 1, 2)
+	to := createGroup(t, s, "CS1010", 3)
+
+	// Members keep when they joined, so that they keep their place in the
+	// queue.
+	if err := s.Groups.MoveMember(from, to, 1); err != nil {
+		t.Fatalf("MoveMember = %v", err)
+	}
+	assertMembers(t, s, from, 2)
+	assertMembers(t, s, to, 1, 3)
+
+	const missing = "00000000-0000-0000-0000-000000000000"
+	if err := s.Groups.MoveMember(from, to, 4); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("MoveMember of non-member = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	if err := s.Groups.MoveMember(from, missing, 2); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("MoveMember into missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	if err := s.Groups.MoveMember(missing, to, 2); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("MoveMember out of missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	assertMembers(t, s, from, 2)
+
+	// A group left without members is removed.
+	if err := s.Groups.MoveMember(from, to, 2); err != nil {
+		t.Fatalf("MoveMember = %v", err)
+	}
+	assertDeleted(t, s, from)
+	assertMembers(t, s, to, 1, 2, 3)
+}
+
+func testMergeGroups(t *testing.T, s Services) {
+	createModules(t, s, "CS1010")
+	createUsers(t, s, 1, 2, 3)
+	into := createGroup(t, s, "CS1010", 1)
+	from := createGroup(t, s, "CS1010", 2, 3)
+
+	const missing = "00000000-0000-0000-0000-000000000000"
+	if err := s.Groups.MergeGroups(from, missing); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("MergeGroups into missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	if err := s.Groups.MergeGroups(missing, into); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("MergeGroups of missing group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+	assertMembers(t, s, from, 2, 3)
+
+	// Members keep when they joined, so that they keep their place in the
+	// queue.
+	if err := s.Groups.MergeGroups(from, into); err != nil {
+		t.Fatalf("MergeGroups = %v", err)
+	}
+	assertDeleted(t, s, from)
+	assertMembers(t, s, into, 1, 2, 3)
+}
+
+func testDeactivateUser(t *testing.T, s Services) {
+	createModules(t, s, "CS1010", "CS2030")
+	createUsers(t, s, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+
+	// The smallest other forming group of the module gives up its longest
+	// waiting member to the group the user leaves.
+	group := createGroup(t, s, "CS1010", 1, 2, 3)
+	donor := createGroup(t, s, "CS1010", 4)
+	invited := createGroup(t, s, "CS2030", 1, 5)
+	alone := createGroup(t, s, "CS2030", 6)
+	err := s.Groups.AssignInviteLinks([]modwithfriends.InviteLinkAssignment{{GroupID: invited, InviteLink: "https://t.me/1"}})
+	if err != nil {
+		t.Fatalf("AssignInviteLinks = %v", err)
+	}
+
+	if err := s.Users.DeactivateUser(1); err != nil {
+		t.Fatalf("DeactivateUser = %v", err)
+	}
+
+	assertMembers(t, s, group, 2, 3, 4)
+	assertDeleted(t, s, donor)
+	// Invited groups keep their members.
+	assertMembers(t, s, invited, 1, 5)
+	assertMembers(t, s, alone, 6)
+	assertUsers(t, s, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+
+	// A group as large as the one the user leaves gives up no member, as that
+	// would only move the empty seat.
+	same := createGroup(t, s, "CS1010", 8, 9, 10)
+	other := createGroup(t, s, "CS1010", 11, 12)
+	if err := s.Users.DeactivateUser(8); err != nil {
+		t.Fatalf("DeactivateUser = %v", err)
+	}
+	assertMembers(t, s, same, 9, 10)
+	assertMembers(t, s, other, 11, 12)
+
+	// A group left without members is removed.
+	lonely := createGroup(t, s, "CS2030", 7)
+	if err := s.Users.DeactivateUser(7); err != nil {
+		t.Fatalf("DeactivateUser = %v", err)
+	}
+	assertDeleted(t, s, lonely)
+}
+
+func testDeleteUser(t *testing.T, s Services) {
+	createModules(t, s, "CS1010")
+	createUsers(t, s, 1, 2)
+	groupID := createGroup(t, s, "CS1010", 1, 2)
+
+	if err := s.Users.DeleteUser(1); err != nil {
+		t.Fatalf("DeleteUser = %v", err)
+	}
+	if err := s.Users.DeleteUser(1); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("DeleteUser of missing user = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+
+	assertMembers(t, s, groupID, 2)
+	assertUsers(t, s, 2)
+}
+
+func createUsers(t *testing.T, s Services, chatIDs ...modwithfriends.ChatID) {
+	t.Helper()
+	for _, chatID := range chatIDs {
+		if err := s.Users.CreateUser(chatID); err != nil {
+			t.Fatalf("CreateUser(%d) = %v", chatID, err)
+		}
+	}
+}
+
+func createModules(t *testing.T, s Services, codes ...modwithfriends.ModuleCode) {
+	t.Helper()
+	for _, code := range codes {
+		if err := s.Modules.CreateModule(code); err != nil {
+			t.Fatalf("CreateModule(%s) = %v", code, err)
+		}
+	}
+}
+
+// createGroup creates a group, after a pause so that groups are created in
+// the order this is called in.
+func createGroup(t *testing.T, s Services, code modwithfriends.ModuleCode, members ...modwithfriends.ChatID) string {
+	t.Helper()
+	wait()
+	groupID, err := s.Groups.CreateGroup(modwithfriends.Group{ModuleCode: code, Members: members})
+	if err != nil {
+		t.Fatalf("CreateGroup = %v", err)
+	}
+	return groupID
+}
+
+func assertUsers(t *testing.T, s Services, want ...modwithfriends.ChatID) {
+	t.Helper()
+	users, err := s.Users.Users()
+	if err != nil {
+		t.Fatalf("Users = %v", err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("Users = %v, want %v", users, want)
+	}
+}
+
+func assertMembers(t *testing.T, s Services, groupID string, want ...modwithfriends.ChatID) modwithfriends.Group {
+	t.Helper()
+	group, err := s.Groups.Group(groupID)
+	if err != nil {
+		t.Fatalf("Group = %v", err)
+	}
+	if want == nil {
+		want = []modwithfriends.ChatID{}
+	}
+	if !reflect.DeepEqual(group.Members, want) {
+		t.Errorf("Group.Members = %v, want %v", group.Members, want)
+	}
+	return group
+}
+
+func assertInviteLink(t *testing.T, s Services, groupID string, want string) {
+	t.Helper()
+	group, err := s.Groups.Group(groupID)
+	if err != nil {
+		t.Fatalf("Group = %v", err)
+	}
+	got := ""
+	if group.InviteLink != nil {
+		got = *group.InviteLink
+	}
+	if got != want {
+		t.Errorf("Group.InviteLink = %q, want %q", got, want)
+	}
+}
+
+func assertDeleted(t *testing.T, s Services, groupID string) {
+	t.Helper()
+	if _, err := s.Groups.Group(groupID); err != modwithfriends.ErrEntityNotFound {
+		t.Errorf("Group of removed group = %v, want %v", err, modwithfriends.ErrEntityNotFound)
+	}
+}
+
+func groupIDs(groups []modwithfriends.Group) []string {
+	ids := []string{}
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	return ids
+}
+
+func sortedIDs(ids ...string) []string {
+	sort.Strings(ids)
+	return ids
+}
+
+// wait lets the clock move on, so that what is created next is created later
+// at the microseconds databases keep time in.
+func wait() {
+	time.Sleep(2 * time.Millisecond)
+}
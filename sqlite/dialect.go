@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"modwithfriends/sqlstore"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect is SQLite's SQL, for the sqlstore services.
+type Dialect struct{}
+
+var _ sqlstore.Dialect = Dialect{}
+
+// GroupMembersColumn orders the members in a subquery, as SQLite cannot order
+// within an aggregate.
+func (Dialect) GroupMembersColumn() string {
+	return `(SELECT group_concat(user_id) FROM
+		(SELECT user_id FROM memberships WHERE group_id=groups.id ORDER BY created_at, user_id)) AS member_ids`
+}
+
+// UUID generates a version 4 UUID, as SQLite has no function for it.
+func (Dialect) UUID() string {
+	return `lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+		substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))`
+}
+
+// JSON keeps JSON as a blob, so that it is scanned back as bytes.
+func (Dialect) JSON(placeholder string) string {
+	return `CAST(` + placeholder + ` AS BLOB)`
+}
+
+// List keeps lists as JSON arrays, standing in for Postgres' text arrays.
+func (Dialect) List(list []string) interface{} {
+	return stringList(list)
+}
+
+func (Dialect) ScanList(src interface{}) ([]string, error) {
+	list := stringList{}
+	if err := list.Scan(src); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (Dialect) ListContains(column string, placeholder string) string {
+	return `instr(` + column + `, '"' || ` + placeholder + ` || '"') > 0`
+}
+
+// SkipLocked is left out, as transactions take the write lock as they begin.
+func (Dialect) SkipLocked() string {
+	return ``
+}
+
+// IsDuplicate tells whether err is a unique or primary key constraint
+// failing, which Postgres reports as 23505.
+func (Dialect) IsDuplicate(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// IsForeignKeyViolation tells whether err is a foreign key constraint failing,
+// which Postgres reports as 23503. SQLite reports ON DELETE RESTRICT failing as
+// a trigger, so it is told apart by its message.
+func (Dialect) IsForeignKeyViolation(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey ||
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintTrigger && strings.HasPrefix(sqliteErr.Error(), "FOREIGN KEY")))
+}
+
+// stringList is kept as a JSON array.
+type stringList []string
+
+func (sl stringList) Value() (driver.Value, error) {
+	if sl == nil {
+		sl = stringList{}
+	}
+	b, err := json.Marshal([]string(sl))
+	return string(b), err
+}
+
+func (sl *stringList) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), (*[]string)(sl))
+	case []byte:
+		return json.Unmarshal(src, (*[]string)(sl))
+	default:
+		return fmt.Errorf("Failed to scan %T into string list", src)
+	}
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+var migrationFileRx = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// Migration changes the schema from the previous version to Version. SQLite
+// databases are only ever migrated forward.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read migrations: %w", err)
+	}
+
+	migrations := []Migration{}
+	for _, entry := range entries {
+		match := migrationFileRx.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Failed to read migrations: %s is not named like 0001_name.sql", entry.Name())
+		}
+
+		b, err := migrationFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migrations = append(migrations, Migration{Version: version, Name: match[2], SQL: string(b)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("Failed to read migrations: expected version %d but found %d", i+1, m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrate applies the migrations the database has yet to be in a single
+// transaction, which holds the write lock so that processes sharing the file
+// take turns, and returns them.
+func Migrate(db *sqlx.DB) ([]Migration, error) {
+	migrations, err := migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start transaction to migrate database: %w", err)
+	}
+	defer tx.Rollback()
+
+	const createQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT (` + now + `)
+	)`
+	if _, err := tx.Exec(createQuery); err != nil {
+		return nil, fmt.Errorf("Failed to create schema migrations table: %w", err)
+	}
+
+	var version int
+	err = tx.QueryRowx(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query schema version from database: %w", err)
+	}
+	if version > len(migrations) {
+		return nil, fmt.Errorf("Failed to migrate: database is at version %d, which this binary does not know of", version)
+	}
+
+	for _, m := range migrations[version:] {
+		if _, err := tx.Exec(m.SQL); err != nil {
+			return nil, fmt.Errorf("Failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		_, err := tx.Exec(`INSERT INTO schema_migrations(version, name) VALUES(?1, ?2)`, m.Version, m.Name)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to record migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Failed to commit migrations: %w", err)
+	}
+
+	return migrations[version:], nil
+}
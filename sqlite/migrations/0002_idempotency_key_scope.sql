@@ -0,0 +1,15 @@
+-- Keys are scoped to the API key that used them, so that clients cannot replay
+-- or block each other's requests. Keys saved so far belong to no API key and
+-- are dropped, they would have expired within a day anyway. The shared
+-- password has no API key ID and uses the empty string.
+DROP TABLE idempotency_keys;
+
+CREATE TABLE idempotency_keys (
+    api_key_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER,
+    body BLOB,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+    PRIMARY KEY (api_key_id, key)
+);
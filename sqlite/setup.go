@@ -0,0 +1,131 @@
+// Package sqlite opens a single SQLite file for the sqlstore services to keep
+// everything in, for small deployments and local demos. Group events cannot be
+// shared between instances, so it suits a single instance only.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"modwithfriends/metrics"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	dialect = "sqlite3"
+	// Scheme starts the URLs of SQLite databases, e.g. sqlite:///var/data/mwf.db
+	// or sqlite::memory:.
+	Scheme = "sqlite:"
+
+	// timeFormat is how times are kept, matching now.
+	timeFormat = "2006-01-02 15:04:05.000000"
+	// now is the current time in timeFormat, for use in column defaults.
+	// Queries call now() instead, as Postgres does.
+	now = `strftime('%Y-%m-%d %H:%M:%f000', 'now')`
+)
+
+// placeholder matches Postgres' $1 placeholders, which SQLite would take as
+// named parameters and number in the order they first appear.
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// Open opens the database at the sqlite: URL, creating it if it does not
+// exist.
+func Open(databaseURL string) (*sqlx.DB, error) {
+	if !strings.HasPrefix(databaseURL, Scheme) {
+		return nil, fmt.Errorf("Failed to parse database URL: it does not start with %s", Scheme)
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(databaseURL, Scheme), "//")
+
+	// Transactions take the write lock as they begin, so that two of them
+	// cannot both read and then fail to write.
+	dsn := "file:" + path + "?_foreign_keys=1&_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL"
+	db := sqlx.NewDb(sql.OpenDB(connector{dsn}), dialect)
+
+	// SQLite writes one transaction at a time anyway, and a single connection
+	// lets an in-memory database be shared.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+type connector struct {
+	dsn string
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return timedConn{conn}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{ConnectHook: registerNow}
+}
+
+// registerNow adds now(), for queries to take the current time as they do in
+// Postgres.
+func registerNow(conn *sqlite3.SQLiteConn) error {
+	return conn.RegisterFunc("now", func() string {
+		return time.Now().UTC().Format(timeFormat)
+	}, false)
+}
+
+// timedConn takes queries written for Postgres by rewriting their $1
+// placeholders as ?1, and writes times as UTC in timeFormat, so that they
+// compare with each other as text. It times every statement as the postgres
+// package does.
+type timedConn struct {
+	driver.Conn
+}
+
+func (tc timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observe("query", time.Now())
+	return tc.Conn.(driver.QueryerContext).QueryContext(ctx, rewritePlaceholders(query), formatTimes(args))
+}
+
+func (tc timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observe("exec", time.Now())
+	return tc.Conn.(driver.ExecerContext).ExecContext(ctx, rewritePlaceholders(query), formatTimes(args))
+}
+
+func (tc timedConn) Prepare(query string) (driver.Stmt, error) {
+	return tc.Conn.Prepare(rewritePlaceholders(query))
+}
+
+func (tc timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	defer observe("begin", time.Now())
+	return tc.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (tc timedConn) Ping(ctx context.Context) error {
+	return tc.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func rewritePlaceholders(query string) string {
+	return placeholder.ReplaceAllString(query, "?$1")
+}
+
+func formatTimes(args []driver.NamedValue) []driver.NamedValue {
+	for i, arg := range args {
+		if t, ok := arg.Value.(time.Time); ok {
+			args[i].Value = t.UTC().Format(timeFormat)
+		}
+	}
+	return args
+}
+
+func observe(operation string, start time.Time) {
+	metrics.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,28 @@
+package sqlite_test
+
+import (
+	"modwithfriends/servicetest"
+	"modwithfriends/sqlite"
+	"modwithfriends/sqlstore"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) servicetest.Services {
+		db, err := sqlite.Open("sqlite::memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if _, err := sqlite.Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+
+		return servicetest.Services{
+			Users:   &sqlstore.UserService{DB: db, Dialect: sqlite.Dialect{}},
+			Modules: &sqlstore.ModuleService{DB: db, Dialect: sqlite.Dialect{}},
+			Groups:  &sqlstore.GroupService{DB: db, Dialect: sqlite.Dialect{}},
+		}
+	})
+}
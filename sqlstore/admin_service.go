@@ -0,0 +1,112 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"modwithfriends"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type AdminService struct {
+	DB      *sqlx.DB
+	Dialect Dialect
+}
+
+func (as *AdminService) Admin(adminID string) (modwithfriends.Admin, error) {
+	const query = `SELECT * FROM admins WHERE id=$1`
+	return as.queryAdmin(query, adminID)
+}
+
+func (as *AdminService) AdminByUsername(username string) (modwithfriends.Admin, error) {
+	const query = `SELECT * FROM admins WHERE username=$1`
+	return as.queryAdmin(query, username)
+}
+
+func (as *AdminService) CreateAdmin(a modwithfriends.Admin) (string, error) {
+	a.ID = uuid.New().String()
+
+	const query = `INSERT INTO admins(id, username, password_hash) VALUES(:id, :username, :password_hash)`
+	_, err := as.DB.NamedExec(query, &a)
+	if as.Dialect.IsDuplicate(err) {
+		return "", modwithfriends.ErrDuplicateEntityFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to add new admin into database: %w", err)
+	}
+
+	return a.ID, nil
+}
+
+func (as *AdminService) UpdateAdmin(adminID string, updatedAdmin modwithfriends.Admin) error {
+	updatedAdmin.ID = adminID
+
+	const query = `UPDATE admins SET username=:username, password_hash=:password_hash, updated_at=now() WHERE id=:id`
+	res, err := as.DB.NamedExec(query, &updatedAdmin)
+	if err != nil {
+		return fmt.Errorf("Failed to update admin in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after updating admin in database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
+
+func (as *AdminService) Session(tokenHash string) (modwithfriends.AdminSession, error) {
+	session := modwithfriends.AdminSession{}
+
+	const query = `SELECT * FROM admin_sessions WHERE token_hash=$1 AND expires_at > now()`
+	err := as.DB.QueryRowx(query, tokenHash).StructScan(&session)
+	if err == sql.ErrNoRows {
+		return modwithfriends.AdminSession{}, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return modwithfriends.AdminSession{}, fmt.Errorf("Failed to query admin session from database: %w", err)
+	}
+
+	return session, nil
+}
+
+// CreateSession also clears out expired sessions, so that they do not pile up.
+func (as *AdminService) CreateSession(s modwithfriends.AdminSession) error {
+	const deleteExpiredQuery = `DELETE FROM admin_sessions WHERE expires_at <= now()`
+	_, err := as.DB.Exec(deleteExpiredQuery)
+	if err != nil {
+		return fmt.Errorf("Failed to remove expired admin sessions from database: %w", err)
+	}
+
+	const query = `INSERT INTO admin_sessions(token_hash, admin_id, expires_at) VALUES(:token_hash, :admin_id, :expires_at)`
+	_, err = as.DB.NamedExec(query, &s)
+	if err != nil {
+		return fmt.Errorf("Failed to add new admin session into database: %w", err)
+	}
+
+	return nil
+}
+
+func (as *AdminService) DeleteSession(tokenHash string) error {
+	const query = `DELETE FROM admin_sessions WHERE token_hash=$1`
+	_, err := as.DB.Exec(query, tokenHash)
+	if err != nil {
+		return fmt.Errorf("Failed to remove admin session from database: %w", err)
+	}
+	return nil
+}
+
+func (as *AdminService) queryAdmin(stmt string, args ...interface{}) (modwithfriends.Admin, error) {
+	admin := modwithfriends.Admin{}
+
+	err := as.DB.QueryRowx(stmt, args...).StructScan(&admin)
+	if err == sql.ErrNoRows {
+		return modwithfriends.Admin{}, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return modwithfriends.Admin{}, fmt.Errorf("Failed to query admin from database: %w", err)
+	}
+
+	return admin, nil
+}
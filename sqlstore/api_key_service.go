@@ -0,0 +1,126 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"modwithfriends"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIKeyService struct {
+	DB      *sqlx.DB
+	Dialect Dialect
+}
+
+// apiKeyRow is an APIKey as stored in the database, with its scopes kept in a
+// list of the dialect's.
+type apiKeyRow struct {
+	modwithfriends.APIKey
+	Scopes interface{} `db:"scopes"`
+}
+
+func (ks *APIKeyService) newAPIKeyRow(k modwithfriends.APIKey) apiKeyRow {
+	scopes := []string{}
+	for _, scope := range k.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	return apiKeyRow{APIKey: k, Scopes: ks.Dialect.List(scopes)}
+}
+
+func (ks *APIKeyService) apiKey(row apiKeyRow) (modwithfriends.APIKey, error) {
+	scopes, err := ks.Dialect.ScanList(row.Scopes)
+	if err != nil {
+		return modwithfriends.APIKey{}, fmt.Errorf("Failed to parse api key's scopes from database: %w", err)
+	}
+
+	k := row.APIKey
+	k.Scopes = []modwithfriends.Scope{}
+	for _, scope := range scopes {
+		k.Scopes = append(k.Scopes, modwithfriends.Scope(scope))
+	}
+	return k, nil
+}
+
+func (ks *APIKeyService) APIKeys() ([]modwithfriends.APIKey, error) {
+	rows := []apiKeyRow{}
+
+	const query = `SELECT * FROM api_keys ORDER BY created_at`
+	err := ks.DB.Select(&rows, query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query api keys from database: %w", err)
+	}
+
+	keys := []modwithfriends.APIKey{}
+	for _, row := range rows {
+		k, err := ks.apiKey(row)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (ks *APIKeyService) APIKey(keyID string) (modwithfriends.APIKey, error) {
+	const query = `SELECT * FROM api_keys WHERE id=$1`
+	return ks.queryAPIKey(query, keyID)
+}
+
+func (ks *APIKeyService) APIKeyByHash(hash string) (modwithfriends.APIKey, error) {
+	const query = `SELECT * FROM api_keys WHERE key_hash=$1`
+	return ks.queryAPIKey(query, hash)
+}
+
+func (ks *APIKeyService) CreateAPIKey(k modwithfriends.APIKey) (string, error) {
+	k.ID = uuid.New().String()
+
+	const query = `INSERT INTO api_keys(id, name, prefix, key_hash, scopes, expires_at)
+		VALUES(:id, :name, :prefix, :key_hash, :scopes, :expires_at)`
+	row := ks.newAPIKeyRow(k)
+	_, err := ks.DB.NamedExec(query, &row)
+	if ks.Dialect.IsDuplicate(err) {
+		return "", modwithfriends.ErrDuplicateEntityFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to add new api key into database: %w", err)
+	}
+
+	return k.ID, nil
+}
+
+func (ks *APIKeyService) UpdateAPIKey(keyID string, updatedKey modwithfriends.APIKey) error {
+	updatedKey.ID = keyID
+
+	const query = `UPDATE api_keys SET name=:name, prefix=:prefix, key_hash=:key_hash, scopes=:scopes,
+		expires_at=:expires_at, revoked_at=:revoked_at, updated_at=now() WHERE id=:id`
+	row := ks.newAPIKeyRow(updatedKey)
+	res, err := ks.DB.NamedExec(query, &row)
+	if err != nil {
+		return fmt.Errorf("Failed to update api key in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after updating api key in database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
+
+func (ks *APIKeyService) queryAPIKey(stmt string, args ...interface{}) (modwithfriends.APIKey, error) {
+	row := apiKeyRow{}
+
+	err := ks.DB.QueryRowx(stmt, args...).StructScan(&row)
+	if err == sql.ErrNoRows {
+		return modwithfriends.APIKey{}, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return modwithfriends.APIKey{}, fmt.Errorf("Failed to query api key from database: %w", err)
+	}
+
+	return ks.apiKey(row)
+}
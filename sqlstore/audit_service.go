@@ -0,0 +1,95 @@
+package sqlstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"modwithfriends"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditService struct {
+	DB *sqlx.DB
+}
+
+// auditEntryRow is an AuditEntry as stored in the database, where snapshots
+// that were not taken are NULL.
+type auditEntryRow struct {
+	modwithfriends.AuditEntry
+	Before []byte `db:"before"`
+	After  []byte `db:"after"`
+}
+
+func (row auditEntryRow) auditEntry() modwithfriends.AuditEntry {
+	e := row.AuditEntry
+	e.Before = row.Before
+	e.After = row.After
+	return e
+}
+
+func (as *AuditService) Record(e modwithfriends.AuditEntry) error {
+	const query = `INSERT INTO audit_log(actor, action, entity_type, entity_id, before, after) VALUES($1, $2, $3, $4, $5, $6)`
+	_, err := as.DB.Exec(query, e.Actor, e.Action, e.EntityType, e.EntityID, snapshot(e.Before), snapshot(e.After))
+	if err != nil {
+		return fmt.Errorf("Failed to add audit entry into database: %w", err)
+	}
+	return nil
+}
+
+func (as *AuditService) Entries(q modwithfriends.AuditQuery) ([]modwithfriends.AuditEntry, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if q.Actor != nil {
+		where("actor=$%d", *q.Actor)
+	}
+	if q.Action != nil {
+		where("action=$%d", *q.Action)
+	}
+	if q.EntityType != nil {
+		where("entity_type=$%d", *q.EntityType)
+	}
+	if q.EntityID != nil {
+		where("entity_id=$%d", *q.EntityID)
+	}
+	if q.Before != nil {
+		where("id<$%d", *q.Before)
+	}
+
+	query := `SELECT * FROM audit_log`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	rows := []auditEntryRow{}
+	err := as.DB.Select(&rows, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query audit entries from database: %w", err)
+	}
+
+	entries := []modwithfriends.AuditEntry{}
+	for _, row := range rows {
+		entries = append(entries, row.auditEntry())
+	}
+
+	return entries, nil
+}
+
+// snapshot passes a snapshot as text, as pq would otherwise send it as bytea.
+func snapshot(s json.RawMessage) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	return string(s)
+}
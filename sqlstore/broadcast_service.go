@@ -0,0 +1,122 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"modwithfriends"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type BroadcastService struct {
+	DB *sqlx.DB
+}
+
+func (bs *BroadcastService) Broadcast(broadcastID string) (modwithfriends.Broadcast, error) {
+	broadcast := modwithfriends.Broadcast{}
+
+	const query = `SELECT * FROM broadcasts WHERE id=$1`
+	err := bs.DB.QueryRowx(query, broadcastID).StructScan(&broadcast)
+	if err == sql.ErrNoRows {
+		return modwithfriends.Broadcast{}, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return modwithfriends.Broadcast{}, fmt.Errorf("Failed to query broadcast by broadcastID from database: %w", err)
+	}
+
+	failures, err := broadcastFailures(bs.DB, broadcast.ID)
+	if err != nil {
+		return modwithfriends.Broadcast{}, fmt.Errorf("Failed to get broadcast's failures from database: %w", err)
+	}
+	broadcast.Failures = failures
+
+	return broadcast, nil
+}
+
+func (bs *BroadcastService) CreateBroadcast(b modwithfriends.Broadcast) (string, error) {
+	tx, err := bs.DB.Beginx()
+	if err != nil {
+		return "", fmt.Errorf("Failed to start transaction to add new broadcast to database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	broadcastID := uuid.New().String()
+	b.ID = broadcastID
+
+	const createBroadcastQuery = `INSERT INTO broadcasts(id, subject, message) VALUES(:id, :subject, :message)`
+	_, err = tx.NamedExec(createBroadcastQuery, &b)
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("Failed to add new broadcast into database: %w", err)
+	}
+
+	const createFailureQuery = `INSERT INTO broadcast_failures(broadcast_id, user_id, reason, code) VALUES($1, $2, $3, $4)`
+	for _, failure := range b.Failures {
+		_, err := tx.Exec(createFailureQuery, &broadcastID, &failure.User, &failure.ReasonString, &failure.Code)
+		if err != nil {
+			tx.Rollback()
+			return "", fmt.Errorf("Failed to add failures of new broadcast into database: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("Failed to commit transaction to add new broadcast into database: %w", err)
+	}
+
+	return broadcastID, nil
+}
+
+// UpdateFailures replaces the broadcast's unresolved failures with the given
+// failures. Unresolved failures that are left out are marked as resolved.
+func (bs *BroadcastService) UpdateFailures(broadcastID string, failures []modwithfriends.BroadcastFailure) error {
+	tx, err := bs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction to update broadcast's failures in database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	existingFailures, err := broadcastFailures(tx, broadcastID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to get broadcast's existing failures for comparison: %w", err)
+	}
+
+	updatedFailures := map[modwithfriends.ChatID]modwithfriends.BroadcastFailure{}
+	for _, failure := range failures {
+		updatedFailures[failure.User] = failure
+	}
+
+	const updateFailureQuery = `UPDATE broadcast_failures SET reason=$3, code=$4, updated_at=now() WHERE broadcast_id=$1 AND user_id=$2`
+	const resolveFailureQuery = `UPDATE broadcast_failures SET resolved_at=now(), updated_at=now() WHERE broadcast_id=$1 AND user_id=$2`
+	for _, existingFailure := range existingFailures {
+		failure, exist := updatedFailures[existingFailure.User]
+
+		if exist {
+			_, err = tx.Exec(updateFailureQuery, &broadcastID, &failure.User, &failure.ReasonString, &failure.Code)
+		} else {
+			_, err = tx.Exec(resolveFailureQuery, &broadcastID, &existingFailure.User)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to update broadcast's failures in database: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to commit transaction to update broadcast's failures in database: %w", err)
+	}
+
+	return nil
+}
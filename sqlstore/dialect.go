@@ -0,0 +1,41 @@
+// Package sqlstore keeps everything in a SQL database, for the postgres and
+// sqlite packages to share. Queries are written in Postgres' SQL, with $1
+// placeholders and now(), which the sqlite package's driver takes as well. The
+// few parts that cannot be written the same way in both are left to the
+// Dialect.
+package sqlstore
+
+import "time"
+
+// Dialect is what sets the SQL of a database apart from another's.
+type Dialect interface {
+	// GroupMembersColumn lists the members of each group in the member_ids
+	// column, comma separated in the order they joined. It is for use in a
+	// query that joins groups to their memberships as m and groups them by
+	// group.
+	GroupMembersColumn() string
+	// UUID generates a random UUID in a query.
+	UUID() string
+	// JSON is the placeholder of an argument passed as JSON text.
+	JSON(placeholder string) string
+	// List returns the value a list of strings is kept in a column as, and
+	// ScanList reads it back.
+	List(list []string) interface{}
+	ScanList(src interface{}) ([]string, error)
+	// ListContains is the condition for the list kept in column to contain
+	// the text placeholder.
+	ListContains(column string, placeholder string) string
+	// SkipLocked ends a SELECT that locks the rows it selects for the rest of
+	// the transaction, skipping rows that are already locked.
+	SkipLocked() string
+	// IsDuplicate tells whether err is a unique constraint failing.
+	IsDuplicate(err error) bool
+	// IsForeignKeyViolation tells whether err is a foreign key constraint
+	// failing.
+	IsForeignKeyViolation(err error) bool
+}
+
+// timeOf rounds t to what databases keep of times.
+func timeOf(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
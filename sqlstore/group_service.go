@@ -0,0 +1,332 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"modwithfriends"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type GroupService struct {
+	DB      *sqlx.DB
+	Dialect Dialect
+}
+
+func (gs *GroupService) Groups() ([]modwithfriends.Group, error) {
+	query := `SELECT groups.*, ` + gs.Dialect.GroupMembersColumn() + ` FROM groups
+		LEFT JOIN memberships AS m ON groups.id=m.group_id GROUP BY groups.id`
+	return queryGroups(gs.DB, query)
+}
+
+func (gs *GroupService) Group(groupID string) (modwithfriends.Group, error) {
+	row := groupRow{}
+
+	query := `SELECT groups.*, ` + gs.Dialect.GroupMembersColumn() + ` FROM groups
+		LEFT JOIN memberships AS m ON groups.id=m.group_id WHERE groups.id=$1 GROUP BY groups.id`
+	err := gs.DB.QueryRowx(query, groupID).StructScan(&row)
+	if err == sql.ErrNoRows {
+		return modwithfriends.Group{}, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return modwithfriends.Group{}, fmt.Errorf("Failed to query group by groupID from database: %w", err)
+	}
+
+	return row.group()
+}
+
+func (gs *GroupService) GroupsBy(query modwithfriends.GroupQuery) ([]modwithfriends.Group, error) {
+	stmt, args, err := groupsByQuery(query, gs.Dialect.GroupMembersColumn())
+	if err != nil {
+		return nil, err
+	}
+
+	return queryGroups(gs.DB, stmt, args...)
+}
+
+func (gs *GroupService) CreateGroup(g modwithfriends.Group) (string, error) {
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return "", fmt.Errorf("Failed to start transaction to add new group to database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	groupID := uuid.New().String()
+	g.ID = groupID
+
+	const createGroupQuery = `INSERT INTO groups(id, invite_link, module_id) VALUES(:id, :invite_link, :module_id)`
+	_, err = tx.NamedExec(createGroupQuery, &g)
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("Failed to add new group into database: %w", err)
+	}
+
+	const createMemberQuery = `INSERT INTO memberships(group_id, user_id) VALUES($1, $2)`
+	for _, member := range g.Members {
+		_, err := tx.Exec(createMemberQuery, &groupID, &member)
+		if err != nil {
+			tx.Rollback()
+			return "", fmt.Errorf("Failed to add members of new group into database: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("Failed to commit transaction to add new group into database: %w", err)
+	}
+
+	return groupID, nil
+}
+
+func (gs *GroupService) UpdateGroup(groupID string, updatedGroup modwithfriends.Group) error {
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction to update group in database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	updatedGroup.ID = groupID
+
+	const updateGroupQuery = `UPDATE groups SET invite_link=:invite_link, updated_at=now() WHERE id=:id`
+	res, err := tx.NamedExec(updateGroupQuery, &updatedGroup)
+	if gs.Dialect.IsDuplicate(err) {
+		tx.Rollback()
+		return modwithfriends.ErrDuplicateEntityFound
+	} else if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to update group in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to get rows affected after updating group in database")
+	} else if rows < 1 {
+		tx.Rollback()
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	members, err := groupMembers(tx, groupID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to get group's existing members for comparison: %w", err)
+	}
+
+	existingMembers := map[modwithfriends.ChatID]modwithfriends.ChatID{}
+	for _, member := range members {
+		existingMembers[member] = member
+	}
+
+	membersToAdd := []modwithfriends.ChatID{}
+	for _, member := range updatedGroup.Members {
+		_, exist := existingMembers[member]
+		if !exist {
+			membersToAdd = append(membersToAdd, member)
+		}
+	}
+
+	updatedMembers := map[modwithfriends.ChatID]modwithfriends.ChatID{}
+	for _, member := range updatedGroup.Members {
+		updatedMembers[member] = member
+	}
+
+	membersToRemove := []modwithfriends.ChatID{}
+	for _, member := range members {
+		_, exist := updatedMembers[member]
+		if !exist {
+			membersToRemove = append(membersToRemove, member)
+		}
+	}
+
+	const createMemberQuery = `INSERT INTO memberships(group_id, user_id) VALUES($1, $2)`
+	for _, member := range membersToAdd {
+		_, err := tx.Exec(createMemberQuery, &groupID, &member)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to add new members of group into database: %w", err)
+		}
+	}
+
+	const deleteMemberQuery = `DELETE FROM memberships WHERE group_id=$1 AND user_id=$2`
+	for _, member := range membersToRemove {
+		_, err := tx.Exec(deleteMemberQuery, &groupID, &member)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to remove members of group from database: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to commit transaction to update group in database: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GroupService) AssignInviteLinks(assignments []modwithfriends.InviteLinkAssignment) error {
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction to assign invite links in database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	const query = `UPDATE groups SET invite_link=$2, updated_at=now() WHERE id=$1 AND invite_link IS NULL`
+	for _, assignment := range assignments {
+		res, err := tx.Exec(query, assignment.GroupID, assignment.InviteLink)
+		if gs.Dialect.IsDuplicate(err) {
+			tx.Rollback()
+			return modwithfriends.ErrDuplicateEntityFound
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to assign invite link to group in database: %w", err)
+		}
+
+		if rows, err := res.RowsAffected(); err != nil {
+			tx.Rollback()
+			return errors.New("Failed to get rows affected after assigning invite link in database")
+		} else if rows < 1 {
+			tx.Rollback()
+			return modwithfriends.ErrEntityNotFound
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to commit transaction to assign invite links in database: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GroupService) MoveMember(fromGroupID string, toGroupID string, chatID modwithfriends.ChatID) error {
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction to move member in database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var toGroupExist bool
+	const toGroupQuery = `SELECT EXISTS(SELECT 1 FROM groups WHERE id=$1)`
+	err = tx.QueryRowx(toGroupQuery, toGroupID).Scan(&toGroupExist)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to query group to move member into from database: %w", err)
+	}
+	if !toGroupExist {
+		tx.Rollback()
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	const moveMemberQuery = `UPDATE memberships SET group_id=$2, updated_at=now() WHERE group_id=$1 AND user_id=$3`
+	res, err := tx.Exec(moveMemberQuery, fromGroupID, toGroupID, chatID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to move member in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to get rows affected after moving member in database")
+	} else if rows < 1 {
+		tx.Rollback()
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	const deleteEmptyGroupQuery = `DELETE FROM groups WHERE id=$1 AND NOT EXISTS(SELECT 1 FROM memberships WHERE group_id=$1)`
+	_, err = tx.Exec(deleteEmptyGroupQuery, fromGroupID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to remove emptied group from database: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to commit transaction to move member in database: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GroupService) MergeGroups(fromGroupID string, intoGroupID string) error {
+	tx, err := gs.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction to merge groups in database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var groupCount int
+	const groupCountQuery = `SELECT COUNT(*) FROM groups WHERE id=$1 OR id=$2`
+	err = tx.QueryRowx(groupCountQuery, fromGroupID, intoGroupID).Scan(&groupCount)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to query groups to merge from database: %w", err)
+	}
+	if groupCount < 2 {
+		tx.Rollback()
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	const moveMembersQuery = `UPDATE memberships SET group_id=$2, updated_at=now() WHERE group_id=$1`
+	_, err = tx.Exec(moveMembersQuery, fromGroupID, intoGroupID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to move members into merged group in database: %w", err)
+	}
+
+	const deleteGroupQuery = `DELETE FROM groups WHERE id=$1`
+	_, err = tx.Exec(deleteGroupQuery, fromGroupID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to remove merged group from database: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to commit transaction to merge groups in database: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GroupService) DeleteGroup(groupID string) error {
+	const query = `DELETE FROM groups WHERE id=$1`
+	res, err := gs.DB.Exec(query, groupID)
+	if err != nil {
+		return fmt.Errorf("Failed to remove group from database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after removing group from database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
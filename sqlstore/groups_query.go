@@ -0,0 +1,93 @@
+package sqlstore
+
+import (
+	"errors"
+	"fmt"
+	"modwithfriends"
+	"strings"
+)
+
+// groupsByQuery returns the query selecting the groups matching query, along
+// with membersColumn, and the arguments to run it with. membersColumn is given
+// the groups joined to their memberships as m and grouped by group.
+func groupsByQuery(query modwithfriends.GroupQuery, membersColumn string) (string, []interface{}, error) {
+	queryArgs := []interface{}{}
+	arg := func(val interface{}) string {
+		queryArgs = append(queryArgs, val)
+		return fmt.Sprintf("$%d", len(queryArgs))
+	}
+
+	where := []string{"TRUE"}
+	having := []string{"TRUE"}
+
+	if query.ModuleCode != nil {
+		where = append(where, "groups.module_id="+arg(query.ModuleCode))
+	}
+
+	if query.MemberCriteriaQuery != nil {
+		memberCriteriaQuery, err := query.MemberCriteriaQuery.String()
+		if err != nil {
+			return "", nil, fmt.Errorf("Failed to generate query for groups by member criteria: %w", err)
+		}
+		having = append(having, "COUNT(m.user_id) "+memberCriteriaQuery)
+	}
+
+	if len(query.States) > 0 {
+		stateConditions := []string{}
+		for _, state := range query.States {
+			condition, err := groupStateCondition(state)
+			if err != nil {
+				return "", nil, fmt.Errorf("Failed to generate query for groups by state: %w", err)
+			}
+			stateConditions = append(stateConditions, condition)
+		}
+		having = append(having, "("+strings.Join(stateConditions, " OR ")+")")
+	}
+
+	sortColumn := "groups.created_at"
+	if query.SortBy == modwithfriends.SortBySize {
+		sortColumn = "COUNT(m.user_id)"
+	} else if query.SortBy != "" && query.SortBy != modwithfriends.SortByCreatedAt {
+		return "", nil, errors.New("Failed to generate query for groups as sort key is invalid")
+	}
+
+	order, comparator := "ASC", ">"
+	if query.Descending {
+		order, comparator = "DESC", "<"
+	}
+
+	if query.After != nil {
+		var sortValue interface{} = query.After.CreatedAt
+		if query.SortBy == modwithfriends.SortBySize {
+			sortValue = query.After.Size
+		}
+		having = append(having,
+			fmt.Sprintf("(%s, groups.id) %s (%s, %s)", sortColumn, comparator, arg(sortValue), arg(query.After.ID)))
+	}
+
+	stmt := fmt.Sprintf(`SELECT groups.*, %s FROM groups LEFT JOIN memberships AS m ON groups.id=m.group_id
+		WHERE %s GROUP BY groups.id HAVING %s ORDER BY %s %s, groups.id %s`,
+		membersColumn, strings.Join(where, " AND "), strings.Join(having, " AND "), sortColumn, order, order)
+
+	if query.Limit > 0 {
+		stmt += " LIMIT " + arg(query.Limit)
+	}
+
+	return stmt, queryArgs, nil
+}
+
+// groupStateCondition returns the condition for a group to be in the state,
+// for use in a query that joins groups to their memberships as m and groups
+// them by group.
+func groupStateCondition(state modwithfriends.GroupState) (string, error) {
+	switch state {
+	case modwithfriends.GroupStateForming:
+		return fmt.Sprintf("(groups.invite_link IS NULL AND COUNT(m.user_id) < %d)", modwithfriends.GroupSize), nil
+	case modwithfriends.GroupStateFull:
+		return fmt.Sprintf("(groups.invite_link IS NULL AND COUNT(m.user_id) >= %d)", modwithfriends.GroupSize), nil
+	case modwithfriends.GroupStateInvited:
+		return "groups.invite_link IS NOT NULL", nil
+	default:
+		return "", errors.New("Group state is invalid")
+	}
+}
@@ -0,0 +1,177 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"modwithfriends"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// groupRow is a group along with its members as listed by the dialect's
+// GroupMembersColumn.
+type groupRow struct {
+	modwithfriends.Group
+	MemberIDs *string `db:"member_ids"`
+}
+
+func (gr groupRow) group() (modwithfriends.Group, error) {
+	group := gr.Group
+	group.Members = []modwithfriends.ChatID{}
+	if gr.MemberIDs == nil || *gr.MemberIDs == "" {
+		return group, nil
+	}
+
+	for _, memberID := range strings.Split(*gr.MemberIDs, ",") {
+		id, err := strconv.Atoi(memberID)
+		if err != nil {
+			return modwithfriends.Group{}, fmt.Errorf("Failed to parse group's members from database: %w", err)
+		}
+		group.Members = append(group.Members, modwithfriends.ChatID(id))
+	}
+
+	return group, nil
+}
+
+// queryGroups runs a query selecting groups and the dialect's
+// GroupMembersColumn, so that the groups come with their members in a single
+// round trip.
+func queryGroups(q sqlx.Queryer, stmt string, args ...interface{}) ([]modwithfriends.Group, error) {
+	groups := []modwithfriends.Group{}
+
+	rows, err := q.Queryx(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query groups from database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := groupRow{}
+
+		err := rows.StructScan(&row)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan group from database into struct: %w", err)
+		}
+
+		group, err := row.group()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error occurred with rows when querying for groups from database: %w", err)
+	}
+
+	return groups, nil
+}
+
+func groupMembers(q sqlx.Queryer, groupID string) ([]modwithfriends.ChatID, error) {
+	const query = `SELECT user_id FROM memberships WHERE group_id=$1`
+	rows, err := q.Queryx(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get group's members from database: %w", err)
+	}
+	defer rows.Close()
+
+	members := []modwithfriends.ChatID{}
+	for rows.Next() {
+		var memberID modwithfriends.ChatID
+
+		err := rows.Scan(&memberID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan group's members from database: %w", err)
+		}
+
+		members = append(members, memberID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error occurred with rows when querying for group's members from database: %w", err)
+	}
+
+	return members, nil
+}
+
+func broadcastFailures(q sqlx.Queryer, broadcastID string) ([]modwithfriends.BroadcastFailure, error) {
+	const query = `SELECT user_id, reason, code FROM broadcast_failures WHERE broadcast_id=$1 AND resolved_at IS NULL`
+	rows, err := q.Queryx(query, broadcastID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get broadcast's failures from database: %w", err)
+	}
+	defer rows.Close()
+
+	failures := []modwithfriends.BroadcastFailure{}
+	for rows.Next() {
+		failure := modwithfriends.BroadcastFailure{}
+
+		err := rows.StructScan(&failure)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan broadcast's failures from database: %w", err)
+		}
+
+		failures = append(failures, failure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error occurred with rows when querying for broadcast's failures from database: %w", err)
+	}
+
+	return failures, nil
+}
+
+// backfillGroup moves the longest waiting member of the smallest other forming
+// group of the same module into group, provided that group is smaller than
+// it. Taking from a group as large would only move the empty seat there.
+// Groups left without members are removed.
+func backfillGroup(tx *sqlx.Tx, group modwithfriends.Group) error {
+	var memberCount int
+
+	const memberCountQuery = `SELECT COUNT(*) FROM memberships WHERE group_id=$1`
+	err := tx.QueryRowx(memberCountQuery, group.ID).Scan(&memberCount)
+	if err != nil {
+		return fmt.Errorf("Failed to count group's members in database: %w", err)
+	}
+
+	const deleteGroupQuery = `DELETE FROM groups WHERE id=$1`
+	if memberCount == 0 {
+		_, err := tx.Exec(deleteGroupQuery, group.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to remove empty group from database: %w", err)
+		}
+		return nil
+	}
+
+	var donorGroupID string
+	var donorMemberCount int
+
+	const donorGroupQuery = `SELECT groups.id, COUNT(m.user_id) FROM groups JOIN memberships AS m ON groups.id=m.group_id
+		WHERE groups.invite_link IS NULL AND groups.module_id=$1 AND groups.id<>$2
+		GROUP BY groups.id HAVING COUNT(m.user_id) < $3
+		ORDER BY COUNT(m.user_id) ASC, groups.created_at DESC LIMIT 1`
+	err = tx.QueryRowx(donorGroupQuery, group.ModuleCode, group.ID, memberCount).Scan(&donorGroupID, &donorMemberCount)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to find group to backfill from in database: %w", err)
+	}
+
+	const moveMemberQuery = `UPDATE memberships SET group_id=$1, updated_at=now()
+		WHERE group_id=$2 AND user_id=(SELECT user_id FROM memberships WHERE group_id=$2 ORDER BY created_at ASC LIMIT 1)`
+	_, err = tx.Exec(moveMemberQuery, group.ID, donorGroupID)
+	if err != nil {
+		return fmt.Errorf("Failed to move member into backfilled group in database: %w", err)
+	}
+
+	if donorMemberCount == 1 {
+		_, err := tx.Exec(deleteGroupQuery, donorGroupID)
+		if err != nil {
+			return fmt.Errorf("Failed to remove emptied group from database: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"modwithfriends"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyService struct {
+	DB *sqlx.DB
+}
+
+// Reserve also clears out keys that are a day old, along with keys whose
+// request never finished, e.g. because the server went down halfway.
+func (is *IdempotencyService) Reserve(apiKeyID string, key string, requestHash string) (modwithfriends.IdempotencyRecord, bool, error) {
+	now := time.Now()
+	const deleteExpiredQuery = `DELETE FROM idempotency_keys WHERE created_at < $1
+		OR (status_code IS NULL AND created_at < $2)`
+	_, err := is.DB.Exec(deleteExpiredQuery, now.Add(-24*time.Hour), now.Add(-5*time.Minute))
+	if err != nil {
+		return modwithfriends.IdempotencyRecord{}, false, fmt.Errorf("Failed to remove expired idempotency keys from database: %w", err)
+	}
+
+	const insertQuery = `INSERT INTO idempotency_keys(api_key_id, key, request_hash) VALUES($1, $2, $3)
+		ON CONFLICT (api_key_id, key) DO NOTHING`
+	res, err := is.DB.Exec(insertQuery, apiKeyID, key, requestHash)
+	if err != nil {
+		return modwithfriends.IdempotencyRecord{}, false, fmt.Errorf("Failed to add idempotency key into database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return modwithfriends.IdempotencyRecord{}, false, fmt.Errorf("Failed to get rows affected after adding idempotency key into database: %w", err)
+	} else if rows > 0 {
+		return modwithfriends.IdempotencyRecord{APIKeyID: apiKeyID, Key: key, RequestHash: requestHash}, true, nil
+	}
+
+	record := modwithfriends.IdempotencyRecord{}
+
+	const query = `SELECT * FROM idempotency_keys WHERE api_key_id=$1 AND key=$2`
+	err = is.DB.QueryRowx(query, apiKeyID, key).StructScan(&record)
+	if err == sql.ErrNoRows {
+		// The key expired in between, the request is free to go ahead again.
+		return is.Reserve(apiKeyID, key, requestHash)
+	} else if err != nil {
+		return modwithfriends.IdempotencyRecord{}, false, fmt.Errorf("Failed to query idempotency key from database: %w", err)
+	}
+
+	return record, false, nil
+}
+
+func (is *IdempotencyService) Complete(apiKeyID string, key string, statusCode int, body []byte) error {
+	const query = `UPDATE idempotency_keys SET status_code=$3, body=$4 WHERE api_key_id=$1 AND key=$2`
+	_, err := is.DB.Exec(query, apiKeyID, key, statusCode, body)
+	if err != nil {
+		return fmt.Errorf("Failed to save response of idempotency key into database: %w", err)
+	}
+	return nil
+}
+
+func (is *IdempotencyService) Release(apiKeyID string, key string) error {
+	const query = `DELETE FROM idempotency_keys WHERE api_key_id=$1 AND key=$2`
+	_, err := is.DB.Exec(query, apiKeyID, key)
+	if err != nil {
+		return fmt.Errorf("Failed to remove idempotency key from database: %w", err)
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-package postgres
+package sqlstore
 
 import (
 	"errors"
@@ -9,7 +9,8 @@ import (
 )
 
 type ModuleService struct {
-	DB *sqlx.DB
+	DB      *sqlx.DB
+	Dialect Dialect
 }
 
 func (ms *ModuleService) Modules() ([]modwithfriends.ModuleCode, error) {
@@ -54,6 +55,9 @@ func (ms *ModuleService) Exist(code modwithfriends.ModuleCode) (bool, error) {
 func (ms *ModuleService) CreateModule(code modwithfriends.ModuleCode) error {
 	const query = `INSERT INTO modules(id) VALUES($1)`
 	_, err := ms.DB.Exec(query, code)
+	if ms.Dialect.IsDuplicate(err) {
+		return modwithfriends.ErrDuplicateEntityFound
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to add new module into database: %w", err)
 	}
@@ -63,6 +67,9 @@ func (ms *ModuleService) CreateModule(code modwithfriends.ModuleCode) error {
 func (ms *ModuleService) DeleteModule(code modwithfriends.ModuleCode) error {
 	const query = `DELETE FROM modules WHERE id=$1`
 	res, err := ms.DB.Exec(query, code)
+	if ms.Dialect.IsForeignKeyViolation(err) {
+		return modwithfriends.ErrEntityInUse
+	}
 	if err != nil {
 		return fmt.Errorf("Failed to remove module from database: %w", err)
 	}
@@ -70,7 +77,7 @@ func (ms *ModuleService) DeleteModule(code modwithfriends.ModuleCode) error {
 	if rows, err := res.RowsAffected(); err != nil {
 		return errors.New("Failed to get rows affected after removing module from database")
 	} else if rows < 1 {
-		return errors.New("Failed to remove module from database as rows affected is zero")
+		return modwithfriends.ErrEntityNotFound
 	}
 
 	return nil
@@ -0,0 +1,174 @@
+package sqlstore_test
+
+import (
+	"fmt"
+	"modwithfriends"
+	"modwithfriends/postgres"
+	"modwithfriends/sqlite"
+	"modwithfriends/sqlstore"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const envTestDatabaseURL = "TEST_DATABASE_URL"
+
+type database struct {
+	name    string
+	open    func(b *testing.B) *sqlx.DB
+	dialect sqlstore.Dialect
+}
+
+// databases are what the benchmarks run against: an in-memory SQLite one, and
+// the Postgres one at TEST_DATABASE_URL if it is set.
+var databases = []database{
+	{"sqlite", openSQLite, sqlite.Dialect{}},
+	{"postgres", openPostgres, postgres.Dialect{}},
+}
+
+func openSQLite(b *testing.B) *sqlx.DB {
+	db, err := sqlite.Open("sqlite::memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	if _, err := sqlite.Migrate(db); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+func openPostgres(b *testing.B) *sqlx.DB {
+	databaseURL := os.Getenv(envTestDatabaseURL)
+	if databaseURL == "" {
+		b.Skipf("%s is not set", envTestDatabaseURL)
+	}
+
+	db, err := postgres.Open(databaseURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	if _, err := postgres.Migrate(db); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Exec(`TRUNCATE users, modules, groups, memberships CASCADE`); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+// seedGroups adds a full group for each of n modules, with user 1 in every one
+// of them.
+func seedGroups(b *testing.B, db *sqlx.DB, dialect sqlstore.Dialect, n int) {
+	users := &sqlstore.UserService{DB: db, Dialect: dialect}
+	modules := &sqlstore.ModuleService{DB: db, Dialect: dialect}
+	groups := &sqlstore.GroupService{DB: db, Dialect: dialect}
+
+	for i := 1; i <= n*(modwithfriends.GroupSize-1)+1; i++ {
+		if err := users.CreateUser(modwithfriends.ChatID(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		code := modwithfriends.ModuleCode(fmt.Sprintf("CS%04d", i))
+		if err := modules.CreateModule(code); err != nil {
+			b.Fatal(err)
+		}
+
+		members := []modwithfriends.ChatID{1}
+		for j := 0; j < modwithfriends.GroupSize-1; j++ {
+			members = append(members, modwithfriends.ChatID(2+i*(modwithfriends.GroupSize-1)+j))
+		}
+		if _, err := groups.CreateGroup(modwithfriends.Group{ModuleCode: code, Members: members}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// queryGroupsPerGroup reads groups the way the services did before they read
+// members in the same query: the groups first, then the members of each.
+func queryGroupsPerGroup(db *sqlx.DB, stmt string, args ...interface{}) ([]modwithfriends.Group, error) {
+	groups := []modwithfriends.Group{}
+	if err := db.Select(&groups, stmt, args...); err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		groups[i].Members = []modwithfriends.ChatID{}
+		const query = `SELECT user_id FROM memberships WHERE group_id=$1`
+		if err := db.Select(&groups[i].Members, query, groups[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+// BenchmarkGroupsBy lists 200 full groups, against reading each group's
+// members in a query of its own.
+func BenchmarkGroupsBy(b *testing.B) {
+	for _, d := range databases {
+		b.Run(d.name, func(b *testing.B) {
+			db := d.open(b)
+			seedGroups(b, db, d.dialect, 200)
+			gs := &sqlstore.GroupService{DB: db, Dialect: d.dialect}
+
+			b.Run("single_query", func(b *testing.B) {
+				query := modwithfriends.GroupQuery{
+					States: []modwithfriends.GroupState{modwithfriends.GroupStateFull},
+					SortBy: modwithfriends.SortByCreatedAt,
+				}
+				for i := 0; i < b.N; i++ {
+					if _, err := gs.GroupsBy(query); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run("query_per_group", func(b *testing.B) {
+				stmt := fmt.Sprintf(`SELECT groups.* FROM groups LEFT JOIN memberships AS m ON groups.id=m.group_id
+					GROUP BY groups.id HAVING groups.invite_link IS NULL AND COUNT(m.user_id) >= %d
+					ORDER BY groups.created_at ASC, groups.id ASC`, modwithfriends.GroupSize)
+				for i := 0; i < b.N; i++ {
+					if _, err := queryGroupsPerGroup(db, stmt); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkUserGroups lists the groups of a user in 200 of them, against
+// reading each group's members in a query of its own.
+func BenchmarkUserGroups(b *testing.B) {
+	for _, d := range databases {
+		b.Run(d.name, func(b *testing.B) {
+			db := d.open(b)
+			seedGroups(b, db, d.dialect, 200)
+			us := &sqlstore.UserService{DB: db, Dialect: d.dialect}
+
+			b.Run("single_query", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := us.Groups(1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run("query_per_group", func(b *testing.B) {
+				const stmt = `SELECT * FROM groups WHERE id IN (SELECT group_id FROM memberships WHERE user_id=$1)`
+				for i := 0; i < b.N; i++ {
+					if _, err := queryGroupsPerGroup(db, stmt, 1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package sqlstore
+
+import (
+	"fmt"
+	"math"
+	"modwithfriends"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type StatsService struct {
+	DB *sqlx.DB
+}
+
+func (ss *StatsService) Stats(trendingSince time.Time, trendingLimit int) (modwithfriends.Stats, error) {
+	stats := modwithfriends.Stats{
+		Demand:   []modwithfriends.ModuleDemand{},
+		Trending: []modwithfriends.TrendingModule{},
+	}
+
+	const demandQuery = `SELECT modules.id AS module_id, COUNT(m.user_id) AS users,
+		COUNT(m.user_id) FILTER (WHERE groups.invite_link IS NULL) AS waiting,
+		COUNT(DISTINCT groups.id) AS group_count
+		FROM modules LEFT JOIN groups ON modules.id=groups.module_id LEFT JOIN memberships AS m ON groups.id=m.group_id
+		GROUP BY modules.id ORDER BY users DESC, modules.id ASC`
+	err := ss.DB.Select(&stats.Demand, demandQuery)
+	if err != nil {
+		return modwithfriends.Stats{}, fmt.Errorf("Failed to query demand per module from database: %w", err)
+	}
+
+	const completedQuery = `SELECT COUNT(*) FROM groups WHERE invite_link IS NOT NULL`
+	err = ss.DB.QueryRowx(completedQuery).Scan(&stats.GroupsCompleted)
+	if err != nil {
+		return modwithfriends.Stats{}, fmt.Errorf("Failed to count completed groups in database: %w", err)
+	}
+
+	// A group fills up when its last seat is taken, i.e. when its GroupSize-th
+	// member joined. Members backfilled from other groups may have joined
+	// before the group was created, so such groups took no time to fill. Not
+	// every database has a percentile function, so the median is taken here.
+	fills := []struct {
+		CreatedAt time.Time `db:"created_at"`
+		FilledAt  time.Time `db:"filled_at"`
+	}{}
+	const timeToFillQuery = `SELECT groups.created_at, m.created_at AS filled_at
+		FROM groups JOIN (SELECT group_id, created_at,
+			ROW_NUMBER() OVER (PARTITION BY group_id ORDER BY created_at ASC) AS seat FROM memberships) AS m
+		ON groups.id=m.group_id WHERE m.seat=$1`
+	err = ss.DB.Select(&fills, timeToFillQuery, modwithfriends.GroupSize)
+	if err != nil {
+		return modwithfriends.Stats{}, fmt.Errorf("Failed to query times to fill groups from database: %w", err)
+	}
+
+	timesToFill := []float64{}
+	for _, fill := range fills {
+		timesToFill = append(timesToFill, math.Max(fill.FilledAt.Sub(fill.CreatedAt).Seconds(), 0))
+	}
+	sort.Float64s(timesToFill)
+	if n := len(timesToFill); n > 0 {
+		median := (timesToFill[(n-1)/2] + timesToFill[n/2]) / 2
+		stats.MedianTimeToFill = &median
+	}
+
+	const trendingQuery = `SELECT groups.module_id, COUNT(m.user_id) AS joins
+		FROM memberships AS m JOIN groups ON groups.id=m.group_id
+		WHERE m.created_at >= $1
+		GROUP BY groups.module_id ORDER BY joins DESC, groups.module_id ASC LIMIT $2`
+	err = ss.DB.Select(&stats.Trending, trendingQuery, trendingSince, trendingLimit)
+	if err != nil {
+		return modwithfriends.Stats{}, fmt.Errorf("Failed to query trending modules from database: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,235 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"modwithfriends"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type UserService struct {
+	DB      *sqlx.DB
+	Dialect Dialect
+}
+
+func (us *UserService) Users() ([]modwithfriends.ChatID, error) {
+	const query = `SELECT id FROM users WHERE active`
+	rows, err := us.DB.Queryx(query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query users from database: %w", err)
+	}
+	defer rows.Close()
+
+	users := []modwithfriends.ChatID{}
+	for rows.Next() {
+		var user modwithfriends.ChatID
+
+		err := rows.Scan(&user)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan user from database: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error occurred with rows when querying for users from database: %w", err)
+	}
+
+	return users, nil
+}
+
+func (us *UserService) Exist(chatID modwithfriends.ChatID) (bool, error) {
+	userExists := false
+
+	const query = `SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)`
+	err := us.DB.QueryRowx(query, chatID).Scan(&userExists)
+	if err != nil {
+		return false, fmt.Errorf("Failed to check if user exists in database: %w", err)
+	}
+
+	return userExists, nil
+}
+
+func (us *UserService) CreateUser(chatID modwithfriends.ChatID) error {
+	const query = `INSERT INTO users(id) VALUES($1)`
+	_, err := us.DB.Exec(query, chatID)
+	if us.Dialect.IsDuplicate(err) {
+		return modwithfriends.ErrDuplicateEntityFound
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to add new user into database: %w", err)
+	}
+	return nil
+}
+
+func (us *UserService) Groups(chatID modwithfriends.ChatID) ([]modwithfriends.Group, error) {
+	query := `SELECT groups.*, ` + us.Dialect.GroupMembersColumn() + ` FROM groups
+		LEFT JOIN memberships AS m ON groups.id=m.group_id
+		WHERE groups.id IN (SELECT group_id FROM memberships WHERE user_id=$1) GROUP BY groups.id`
+	groups, err := queryGroups(us.DB, query, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get user's groups from database: %w", err)
+	}
+
+	return groups, nil
+}
+
+func (us *UserService) Email(chatID modwithfriends.ChatID) (*string, error) {
+	var email *string
+
+	const query = `SELECT email FROM users WHERE id=$1`
+	err := us.DB.QueryRowx(query, chatID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return nil, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to query user's email from database: %w", err)
+	}
+
+	return email, nil
+}
+
+func (us *UserService) Emails(chatIDs []modwithfriends.ChatID) (map[modwithfriends.ChatID]string, error) {
+	emails := map[modwithfriends.ChatID]string{}
+	if len(chatIDs) == 0 {
+		return emails, nil
+	}
+
+	placeholders := []string{}
+	args := []interface{}{}
+	for _, chatID := range chatIDs {
+		args = append(args, chatID)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	query := `SELECT id, email FROM users WHERE email IS NOT NULL AND id IN (` + strings.Join(placeholders, ", ") + `)`
+	rows, err := us.DB.Queryx(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query users' emails from database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chatID modwithfriends.ChatID
+		var email string
+
+		err := rows.Scan(&chatID, &email)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan user's email from database: %w", err)
+		}
+
+		emails[chatID] = email
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error occurred with rows when querying for users' emails from database: %w", err)
+	}
+
+	return emails, nil
+}
+
+func (us *UserService) UpdateEmail(chatID modwithfriends.ChatID, email *string) error {
+	const query = `UPDATE users SET email=$2, updated_at=now() WHERE id=$1`
+	res, err := us.DB.Exec(query, chatID, email)
+	if err != nil {
+		return fmt.Errorf("Failed to update user's email in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after updating user's email in database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
+
+func (us *UserService) ActivateUser(chatID modwithfriends.ChatID) error {
+	const query = `UPDATE users SET active=TRUE, deactivated_at=NULL, updated_at=now() WHERE id=$1 AND NOT active`
+	_, err := us.DB.Exec(query, chatID)
+	if err != nil {
+		return fmt.Errorf("Failed to activate user in database: %w", err)
+	}
+	return nil
+}
+
+// DeactivateUser marks the user as inactive and takes them out of every group
+// that has yet to be issued an invite link. The seat each of those groups
+// loses is backfilled with a member of a smaller forming group of the same
+// module, if there is one.
+func (us *UserService) DeactivateUser(chatID modwithfriends.ChatID) error {
+	tx, err := us.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction to deactivate user in database: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	const deactivateUserQuery = `UPDATE users SET active=FALSE, deactivated_at=now(), updated_at=now() WHERE id=$1`
+	res, err := tx.Exec(deactivateUserQuery, chatID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to deactivate user in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		tx.Rollback()
+		return errors.New("Failed to get rows affected after deactivating user in database")
+	} else if rows < 1 {
+		tx.Rollback()
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	formingGroups := []modwithfriends.Group{}
+	const formingGroupsQuery = `SELECT * FROM groups WHERE invite_link IS NULL AND id IN (SELECT group_id FROM memberships WHERE user_id=$1)`
+	err = tx.Select(&formingGroups, formingGroupsQuery, chatID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to get user's forming groups from database: %w", err)
+	}
+
+	const deleteMemberQuery = `DELETE FROM memberships WHERE group_id=$1 AND user_id=$2`
+	for _, group := range formingGroups {
+		_, err := tx.Exec(deleteMemberQuery, group.ID, chatID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to remove user from forming group in database: %w", err)
+		}
+
+		err = backfillGroup(tx, group)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to backfill group after removing user: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to commit transaction to deactivate user in database: %w", err)
+	}
+
+	return nil
+}
+
+func (us *UserService) DeleteUser(chatID modwithfriends.ChatID) error {
+	const query = `DELETE FROM users WHERE id=$1`
+	res, err := us.DB.Exec(query, chatID)
+	if err != nil {
+		return fmt.Errorf("Failed to remove user from database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after removing user from database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
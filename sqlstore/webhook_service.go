@@ -0,0 +1,192 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"modwithfriends"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type WebhookService struct {
+	DB      *sqlx.DB
+	Dialect Dialect
+}
+
+// webhookRow is a Webhook as stored in the database, with its events kept in
+// a list of the dialect's.
+type webhookRow struct {
+	modwithfriends.Webhook
+	Events interface{} `db:"events"`
+}
+
+func (ws *WebhookService) newWebhookRow(w modwithfriends.Webhook) webhookRow {
+	events := []string{}
+	for _, event := range w.Events {
+		events = append(events, string(event))
+	}
+	return webhookRow{Webhook: w, Events: ws.Dialect.List(events)}
+}
+
+func (ws *WebhookService) webhook(row webhookRow) (modwithfriends.Webhook, error) {
+	events, err := ws.Dialect.ScanList(row.Events)
+	if err != nil {
+		return modwithfriends.Webhook{}, fmt.Errorf("Failed to parse webhook's events from database: %w", err)
+	}
+
+	w := row.Webhook
+	w.Events = []modwithfriends.WebhookEvent{}
+	for _, event := range events {
+		w.Events = append(w.Events, modwithfriends.WebhookEvent(event))
+	}
+	return w, nil
+}
+
+func (ws *WebhookService) Webhooks() ([]modwithfriends.Webhook, error) {
+	rows := []webhookRow{}
+
+	const query = `SELECT * FROM webhooks ORDER BY created_at`
+	err := ws.DB.Select(&rows, query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query webhooks from database: %w", err)
+	}
+
+	webhooks := []modwithfriends.Webhook{}
+	for _, row := range rows {
+		w, err := ws.webhook(row)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, nil
+}
+
+func (ws *WebhookService) Webhook(webhookID string) (modwithfriends.Webhook, error) {
+	row := webhookRow{}
+
+	const query = `SELECT * FROM webhooks WHERE id=$1`
+	err := ws.DB.QueryRowx(query, webhookID).StructScan(&row)
+	if err == sql.ErrNoRows {
+		return modwithfriends.Webhook{}, modwithfriends.ErrEntityNotFound
+	} else if err != nil {
+		return modwithfriends.Webhook{}, fmt.Errorf("Failed to query webhook from database: %w", err)
+	}
+
+	return ws.webhook(row)
+}
+
+func (ws *WebhookService) CreateWebhook(w modwithfriends.Webhook) (string, error) {
+	w.ID = uuid.New().String()
+
+	const query = `INSERT INTO webhooks(id, url, secret, events) VALUES(:id, :url, :secret, :events)`
+	row := ws.newWebhookRow(w)
+	_, err := ws.DB.NamedExec(query, &row)
+	if err != nil {
+		return "", fmt.Errorf("Failed to add new webhook into database: %w", err)
+	}
+
+	return w.ID, nil
+}
+
+func (ws *WebhookService) DeleteWebhook(webhookID string) error {
+	const query = `DELETE FROM webhooks WHERE id=$1`
+	res, err := ws.DB.Exec(query, webhookID)
+	if err != nil {
+		return fmt.Errorf("Failed to remove webhook from database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after removing webhook from database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
+
+func (ws *WebhookService) CreateDeliveries(event modwithfriends.WebhookEvent, payload []byte) error {
+	query := `INSERT INTO webhook_deliveries(id, webhook_id, event, payload)
+		SELECT ` + ws.Dialect.UUID() + `, id, $1, ` + ws.Dialect.JSON("$2") + ` FROM webhooks
+		WHERE ` + ws.Dialect.ListContains("events", "$1")
+	_, err := ws.DB.Exec(query, event, string(payload))
+	if err != nil {
+		return fmt.Errorf("Failed to add new webhook deliveries into database: %w", err)
+	}
+	return nil
+}
+
+func (ws *WebhookService) Deliveries(webhookID string, limit int) ([]modwithfriends.WebhookDelivery, error) {
+	deliveries := []modwithfriends.WebhookDelivery{}
+
+	const query = `SELECT * FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY created_at DESC LIMIT $2`
+	err := ws.DB.Select(&deliveries, query, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query webhook deliveries from database: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDeliveries selects and leases the deliveries in one transaction, which
+// holds the rows it selects until it is done.
+func (ws *WebhookService) ClaimDeliveries(limit int, lease time.Duration) ([]modwithfriends.WebhookDelivery, error) {
+	tx, err := ws.DB.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start transaction to claim webhook deliveries in database: %w", err)
+	}
+	defer tx.Rollback()
+
+	claimedAt := timeOf(time.Now())
+	leasedUntil := claimedAt.Add(lease)
+
+	deliveries := []modwithfriends.WebhookDelivery{}
+	query := `SELECT * FROM webhook_deliveries WHERE next_attempt_at <= $1
+		ORDER BY next_attempt_at ASC LIMIT $2 ` + ws.Dialect.SkipLocked()
+	err = tx.Select(&deliveries, query, claimedAt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query due webhook deliveries from database: %w", err)
+	}
+
+	const leaseQuery = `UPDATE webhook_deliveries SET next_attempt_at=$2, updated_at=$3 WHERE id=$1`
+	for i := range deliveries {
+		_, err := tx.Exec(leaseQuery, deliveries[i].ID, leasedUntil, claimedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to claim due webhook delivery in database: %w", err)
+		}
+
+		nextAttemptAt := leasedUntil
+		deliveries[i].NextAttemptAt = &nextAttemptAt
+		deliveries[i].UpdatedAt = claimedAt
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Failed to commit transaction to claim webhook deliveries in database: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (ws *WebhookService) UpdateDelivery(deliveryID string, updatedDelivery modwithfriends.WebhookDelivery) error {
+	updatedDelivery.ID = deliveryID
+
+	const query = `UPDATE webhook_deliveries SET attempts=:attempts, status_code=:status_code, error=:error,
+		next_attempt_at=:next_attempt_at, delivered_at=:delivered_at, failed_at=:failed_at, updated_at=now()
+		WHERE id=:id`
+	res, err := ws.DB.NamedExec(query, &updatedDelivery)
+	if err != nil {
+		return fmt.Errorf("Failed to update webhook delivery in database: %w", err)
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return errors.New("Failed to get rows affected after updating webhook delivery in database")
+	} else if rows < 1 {
+		return modwithfriends.ErrEntityNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package modwithfriends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+type ModuleList []ModuleCode
+
+func (ml ModuleList) String() string {
+	codes := make([]string, 0, len(ml))
+	for _, code := range ml {
+		codes = append(codes, string(code))
+	}
+	return strings.Join(codes, ", ")
+}
+
+// Recipient is the per-user data a broadcast MessageTemplate is filled in with.
+// Modules lists the module codes of the recipient's forming groups.
+type Recipient struct {
+	ChatID        ChatID
+	FirstName     string
+	LastName      string
+	Username      string
+	Groups        []Group
+	FormingGroups []Group
+	Modules       ModuleList
+}
+
+func NewRecipient(chatID ChatID, groups []Group) Recipient {
+	recipient := Recipient{
+		ChatID:        chatID,
+		Groups:        groups,
+		FormingGroups: []Group{},
+		Modules:       ModuleList{},
+	}
+
+	for _, group := range groups {
+		if group.InviteLink == nil {
+			recipient.FormingGroups = append(recipient.FormingGroups, group)
+			recipient.Modules = append(recipient.Modules, group.ModuleCode)
+		}
+	}
+
+	return recipient
+}
+
+type MessageTemplate struct {
+	text string
+	tmpl *template.Template
+	// message is the rendered template when it is the same for every
+	// recipient, and nil otherwise.
+	message *string
+}
+
+// NewMessageTemplate parses text as a text/template and dry runs it against a
+// sample recipient, so that mistakes are caught before any message is sent.
+func NewMessageTemplate(text string) (*MessageTemplate, error) {
+	tmpl, err := template.New("broadcast").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse message template: %w", err)
+	}
+
+	inviteLink := "https://t.me/joinchat/sample"
+	sample := NewRecipient(0, []Group{
+		{ModuleCode: "GEX1007", Members: []ChatID{0}},
+		{ModuleCode: "CS1101S", Members: []ChatID{0}, InviteLink: &inviteLink},
+	})
+	sample.FirstName = "Sample"
+
+	if err := tmpl.Execute(ioutil.Discard, sample); err != nil {
+		return nil, fmt.Errorf("Failed to execute message template against sample recipient: %w", err)
+	}
+
+	mt := &MessageTemplate{text: text, tmpl: tmpl}
+	if isStaticTemplate(tmpl) {
+		// The source still holds comments and trim markers, so it is rendered
+		// rather than sent as is.
+		message, err := mt.Execute(sample)
+		if err != nil {
+			return nil, err
+		}
+		mt.message = &message
+	}
+
+	return mt, nil
+}
+
+// Static returns the message the template renders for every recipient, and
+// whether it is the same for all of them.
+func (mt *MessageTemplate) Static() (string, bool) {
+	if mt.message == nil {
+		return "", false
+	}
+	return *mt.message, true
+}
+
+func (mt *MessageTemplate) String() string {
+	return mt.text
+}
+
+func (mt *MessageTemplate) Execute(recipient Recipient) (string, error) {
+	var sb strings.Builder
+	if err := mt.tmpl.Execute(&sb, recipient); err != nil {
+		return "", fmt.Errorf("Failed to execute message template for user %d: %w", recipient.ChatID, err)
+	}
+	return sb.String(), nil
+}
+
+func isStaticTemplate(tmpl *template.Template) bool {
+	if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+		return true
+	}
+	for _, node := range tmpl.Tree.Root.Nodes {
+		if node.Type() != parse.NodeText {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package modwithfriends
+
+import "testing"
+
+func TestNewMessageTemplate(t *testing.T) {
+	inviteLink := "https://t.me/joinchat/abc"
+	recipient := NewRecipient(1, []Group{
+		{ModuleCode: "CS2030S", Members: []ChatID{1}},
+		{ModuleCode: "MA1521", Members: []ChatID{1}},
+		{ModuleCode: "CS2040S", Members: []ChatID{1}, InviteLink: &inviteLink},
+	})
+	recipient.FirstName = "Ada"
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+		static  bool
+		want    string
+	}{
+		{name: "plain text", text: "Hi all", static: true, want: "Hi all"},
+		{name: "empty", text: "", static: true, want: ""},
+		{name: "comment", text: "Hi {{/* note */}}all", static: true, want: "Hi all"},
+		{name: "trim markers", text: "Hi   {{- /* note */ -}}   all", static: true, want: "Hiall"},
+		{name: "first name", text: "Hi {{.FirstName}}", want: "Hi Ada"},
+		{name: "modules", text: "Still forming: {{.Modules}}", want: "Still forming: CS2030S, MA1521"},
+		{name: "forming groups", text: "{{len .FormingGroups}} of {{len .Groups}}", want: "2 of 3"},
+		{name: "unclosed action", text: "Hi {{.FirstName", wantErr: true},
+		{name: "unknown field", text: "Hi {{.Nickname}}", wantErr: true},
+		{name: "unknown function", text: "Hi {{shout .FirstName}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mt, err := NewMessageTemplate(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewMessageTemplate(%q) succeeded, want error", tt.text)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMessageTemplate(%q) failed: %v", tt.text, err)
+			}
+
+			msg, static := mt.Static()
+			if static != tt.static {
+				t.Errorf("Static() = %v, want %v", static, tt.static)
+			}
+			if static && msg != tt.want {
+				t.Errorf("Static() message = %q, want %q", msg, tt.want)
+			}
+
+			got, err := mt.Execute(recipient)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"modwithfriends"
+	"net/http"
+	"time"
+)
+
+const (
+	maxAttempts   = 8
+	firstBackoff  = 30 * time.Second
+	claimLimit    = 20
+	claimLease    = 2 * time.Minute
+	pollInterval  = 15 * time.Second
+	deliveryLimit = 10 * time.Second
+)
+
+// Dispatcher queues webhook deliveries for group events and sends them in the
+// background, retrying failed ones with exponential backoff. Deliveries are
+// kept in the WebhookService so retries survive restarts and are shared by
+// every instance.
+type Dispatcher struct {
+	WebhookService modwithfriends.WebhookService
+	Client         *http.Client
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewDispatcher(ws modwithfriends.WebhookService) *Dispatcher {
+	return &Dispatcher{
+		WebhookService: ws,
+		Client:         &http.Client{Timeout: deliveryLimit},
+		wake:           make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// Publish queues a delivery to every webhook subscribed to the events that the
+// change to the group amounts to.
+func (d *Dispatcher) Publish(e modwithfriends.GroupEvent) {
+	for _, payload := range payloadsFor(e, time.Now()) {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Failed to encode %s webhook payload: %s", payload.Event, err)
+			continue
+		}
+
+		err = d.WebhookService.CreateDeliveries(payload.Event, body)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start sends due deliveries until Stop is called.
+func (d *Dispatcher) Start() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue()
+
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Stop waits until ctx is done for the delivery being sent. Deliveries that
+// were claimed but not sent are sent again once their lease is up.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	close(d.stop)
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Failed to finish webhook delivery: %w", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) stopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ping sends a ping to the webhook right away, outside of the delivery queue.
+func (d *Dispatcher) Ping(w modwithfriends.Webhook) (int, error) {
+	body, err := json.Marshal(Payload{Event: modwithfriends.WebhookPing, OccurredAt: time.Now()})
+	if err != nil {
+		return 0, fmt.Errorf("Failed to encode ping webhook payload: %w", err)
+	}
+	return d.send(w, "ping", modwithfriends.WebhookPing, body)
+}
+
+func (d *Dispatcher) deliverDue() {
+	if d.stopped() {
+		return
+	}
+
+	deliveries, err := d.WebhookService.ClaimDeliveries(claimLimit, claimLease)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	webhooks := map[string]modwithfriends.Webhook{}
+	for _, delivery := range deliveries {
+		if d.stopped() {
+			return
+		}
+
+		w, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			w, err = d.WebhookService.Webhook(delivery.WebhookID)
+			if err != nil {
+				// The webhook is gone, and its deliveries with it.
+				log.Println(err)
+				continue
+			}
+			webhooks[w.ID] = w
+		}
+
+		d.attempt(w, delivery)
+	}
+
+	// Claim the next batch at once if this one was full.
+	if len(deliveries) == claimLimit {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(w modwithfriends.Webhook, delivery modwithfriends.WebhookDelivery) {
+	statusCode, err := d.send(w, delivery.ID, delivery.Event, delivery.Payload)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.StatusCode = nil
+	if statusCode != 0 {
+		delivery.StatusCode = &statusCode
+	}
+	delivery.Error = nil
+	delivery.NextAttemptAt = nil
+
+	switch {
+	case err == nil:
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxAttempts:
+		log.Printf("Giving up on webhook delivery %s to %s after %d attempts: %s", delivery.ID, w.URL, delivery.Attempts, err)
+		reason := err.Error()
+		delivery.Error = &reason
+		delivery.FailedAt = &now
+	default:
+		log.Printf("Failed webhook delivery %s to %s, attempt %d: %s", delivery.ID, w.URL, delivery.Attempts, err)
+		reason := err.Error()
+		delivery.Error = &reason
+		next := now.Add(backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	err = d.WebhookService.UpdateDelivery(delivery.ID, delivery)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// send posts a signed body to the webhook, any response other than a 2xx is
+// a failure.
+func (d *Dispatcher) send(w modwithfriends.Webhook, deliveryID string, event modwithfriends.WebhookEvent, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "modwithfriends-webhooks")
+	req.Header.Set(EventHeader, string(event))
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, time.Now(), body))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to send webhook request: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("Webhook responded with %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// backoff doubles the wait after every failed attempt, 30s, 1m, 2m and so on.
+func backoff(attempts int) time.Duration {
+	return firstBackoff << (attempts - 1)
+}
@@ -0,0 +1,79 @@
+package webhooks
+
+import (
+	"modwithfriends"
+	"time"
+)
+
+// Payload is the JSON body of a delivery. User is set for user.left.
+type Payload struct {
+	Event      modwithfriends.WebhookEvent `json:"event"`
+	OccurredAt time.Time                   `json:"occurredAt"`
+	Group      *modwithfriends.Group       `json:"group,omitempty"`
+	User       *modwithfriends.ChatID      `json:"user,omitempty"`
+}
+
+// payloadsFor works out the webhook events a change to a group amounts to.
+func payloadsFor(e modwithfriends.GroupEvent, now time.Time) []Payload {
+	group := e.Group
+	payload := func(event modwithfriends.WebhookEvent) Payload {
+		return Payload{Event: event, OccurredAt: now, Group: &group}
+	}
+	userLeft := func(chatID modwithfriends.ChatID) Payload {
+		p := payload(modwithfriends.WebhookUserLeft)
+		p.User = &chatID
+		return p
+	}
+
+	payloads := []Payload{}
+
+	switch e.Type {
+	case modwithfriends.GroupCreated:
+		payloads = append(payloads, payload(modwithfriends.WebhookGroupCreated))
+		if isFull(group) {
+			payloads = append(payloads, payload(modwithfriends.WebhookGroupFull))
+		}
+		if group.InviteLink != nil {
+			payloads = append(payloads, payload(modwithfriends.WebhookGroupLinkIssued))
+		}
+
+	case modwithfriends.GroupUpdated:
+		if e.Previous == nil {
+			break
+		}
+		previous := *e.Previous
+
+		for _, member := range previous.Members {
+			if !hasMember(group, member) {
+				payloads = append(payloads, userLeft(member))
+			}
+		}
+		if isFull(group) && !isFull(previous) {
+			payloads = append(payloads, payload(modwithfriends.WebhookGroupFull))
+		}
+		if group.InviteLink != nil && (previous.InviteLink == nil || *previous.InviteLink != *group.InviteLink) {
+			payloads = append(payloads, payload(modwithfriends.WebhookGroupLinkIssued))
+		}
+
+	case modwithfriends.GroupDeleted:
+		for _, member := range group.Members {
+			payloads = append(payloads, userLeft(member))
+		}
+	}
+
+	return payloads
+}
+
+// isFull is whether the group is waiting on an invite link with no seats left.
+func isFull(g modwithfriends.Group) bool {
+	return g.InviteLink == nil && len(g.Members) >= modwithfriends.GroupSize
+}
+
+func hasMember(g modwithfriends.Group, chatID modwithfriends.ChatID) bool {
+	for _, member := range g.Members {
+		if member == chatID {
+			return true
+		}
+	}
+	return false
+}
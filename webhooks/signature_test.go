@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"group.full","groupId":"abc"}`)
+	sentAt := time.Unix(1700000000, 0)
+	header := Sign(secret, sentAt, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		valid  bool
+	}{
+		{name: "round trip", secret: secret, header: header, body: body, now: sentAt, valid: true},
+		{name: "within tolerance", secret: secret, header: header, body: body, now: sentAt.Add(signatureTolerance), valid: true},
+		{name: "spaces after commas", secret: secret, header: "t=1700000000, v1=" + signature(secret, "1700000000", body), body: body, now: sentAt, valid: true},
+		{name: "tampered body", secret: secret, header: header, body: []byte(`{"type":"group.full","groupId":"abd"}`), now: sentAt},
+		{name: "wrong secret", secret: "whsec_other", header: header, body: body, now: sentAt},
+		{name: "expired", secret: secret, header: header, body: body, now: sentAt.Add(signatureTolerance + time.Second)},
+		{name: "from the future", secret: secret, header: header, body: body, now: sentAt.Add(-signatureTolerance - time.Second)},
+		{name: "tampered timestamp", secret: secret, header: "t=1700000060,v1=" + signature(secret, "1700000000", body), body: body, now: sentAt},
+		{name: "missing signature", secret: secret, header: "t=1700000000", body: body, now: sentAt},
+		{name: "missing timestamp", secret: secret, header: "v1=" + signature(secret, "1700000000", body), body: body, now: sentAt},
+		{name: "empty header", secret: secret, header: "", body: body, now: sentAt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.now)
+			if tt.valid && err != nil {
+				t.Errorf("Verify failed: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}